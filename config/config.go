@@ -1,6 +1,29 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"autentikasi/models"
+)
+
+// ConnectorConfig describes an upstream OpenID Connect provider users can
+// log in with. It is read from OIDC_<ID>_* variables.
+type ConnectorConfig struct {
+	ID           string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// DefaultJWTSecret is the JWT_SECRET used when none is set. It is public,
+// so the service refuses to sign tokens with it.
+const DefaultJWTSecret = "changeme"
 
 type Config struct {
 	AppPort   string
@@ -12,6 +35,102 @@ type Config struct {
 	MySQLDB   string
 	JWTSecret string
 
+	// JWT signing: HS256 uses JWTSecret; RS256/EdDSA use rotating keys from JWTKeyDir
+	JWTAlg         string
+	JWTKeyDir      string
+	JWTKeyRotation time.Duration
+	JWTKeyGrace    time.Duration
+
+	// Registered claims: iss of every token and the audiences (client ids)
+	// access tokens may be issued for; the first one is the default
+	JWTIssuer    string
+	JWTAudiences []string
+
+	// Token lifetimes
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Two-factor authentication
+	TOTPIssuer  string
+	MFATokenTTL time.Duration
+
+	// Passkeys (WebAuthn): the domain passkeys are bound to and the web
+	// origins allowed to use them
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+
+	// Transaction PIN
+	PinMaxAttempts         int
+	PinLockDuration        time.Duration
+	ElevatedTokenTTL       time.Duration
+	LargeTransactionAmount models.Money
+
+	// Transactions: the largest jumlah a single transaction may have
+	TransactionMaxAmount models.Money
+
+	// Brute-force protection
+	AccountMaxAttempts int
+	IPMaxAttempts      int
+	OTPMaxAttempts     int
+	LockoutBase        time.Duration
+	LockoutMax         time.Duration
+	ThrottleWindow     time.Duration
+
+	// Password reset
+	ResetTokenTTL time.Duration
+
+	// Key of the HMAC that one-time codes (reset OTPs, verification
+	// and login codes) are stored under; required, and never JWTSecret
+	CodeHashKey string
+
+	// Password policy: minimum length, character classes that must appear
+	// (letter, lower, upper, digit, symbol), how many previous passwords
+	// cannot be reused and the directory of breached-password range files
+	PasswordMinLength int
+	PasswordClasses   []string
+	PasswordHistory   int
+	PasswordBreachDir string
+
+	// Password hashing: "argon2id" or "bcrypt" for new hashes, and their
+	// parameters. Stored hashes made with other settings are upgraded at
+	// the next successful login.
+	PasswordHashAlg string
+	BcryptCost      int
+	Argon2Memory    int // KiB
+	Argon2Time      int
+	Argon2Threads   int
+
+	// Passwordless login by e-mail: code/link lifetime and the app page the
+	// link opens (the link is left out of the e-mail when empty)
+	MagicLinkTTL time.Duration
+	MagicLinkURL string
+
+	// New-device and suspicious-login alerts: whether they are sent, how
+	// long the "this wasn't me" link works and the app page it opens
+	// (defaults to the API endpoint)
+	LoginAlerts   bool
+	LoginAlertTTL time.Duration
+	LoginAlertURL string
+
+	// E-mail verification
+	AppBaseURL           string
+	RequireVerifiedEmail bool
+
+	// Account deletion: grace period before a deleted account is purged and
+	// how often the purge job runs (0 disables it)
+	AccountDeletionGrace time.Duration
+	PurgeInterval        time.Duration
+
+	// Accounts that get the admin role at startup
+	AdminEmails []string
+
+	// OpenID Connect provider: page of the web app that shows the consent screen
+	OIDCConsentURL string
+
+	// Upstream identity providers (Google, ...) listed in OIDC_CONNECTORS
+	Connectors []ConnectorConfig
+
 	// SMTP Settings
 	MailServer        string
 	MailPort          string
@@ -30,7 +149,86 @@ func Load() *Config {
 		MySQLUser: getEnv("MYSQL_USER", "root"),
 		MySQLPass: getEnv("MYSQL_PASS", ""),
 		MySQLDB:   getEnv("MYSQL_DB", "test"),
-		JWTSecret: getEnv("JWT_SECRET", "changeme"),
+		JWTSecret: getEnv("JWT_SECRET", DefaultJWTSecret),
+
+		// JWT signing
+		JWTAlg:         getEnv("JWT_ALG", "HS256"),
+		JWTKeyDir:      getEnv("JWT_KEY_DIR", ""),
+		JWTKeyRotation: getDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		JWTKeyGrace:    getDuration("JWT_KEY_GRACE", 24*time.Hour),
+		JWTIssuer:      getEnv("JWT_ISSUER", "dompetku-auth"),
+		JWTAudiences:   getList("JWT_AUDIENCES", []string{"dompetku-app"}),
+
+		// Token lifetimes
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		// Two-factor authentication
+		TOTPIssuer:  getEnv("TOTP_ISSUER", "Dompetku"),
+		MFATokenTTL: getDuration("MFA_TOKEN_TTL", 5*time.Minute),
+
+		// Passkeys
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "Dompetku"),
+		WebAuthnOrigins: getList("WEBAUTHN_ORIGINS", []string{"http://localhost:3000"}),
+
+		// Transaction PIN
+		PinMaxAttempts:         getInt("PIN_MAX_ATTEMPTS", 5),
+		PinLockDuration:        getDuration("PIN_LOCK_DURATION", 15*time.Minute),
+		ElevatedTokenTTL:       getDuration("ELEVATED_TOKEN_TTL", 5*time.Minute),
+		LargeTransactionAmount: getMoney("LARGE_TRANSACTION_AMOUNT", models.Rupiah(5000000)),
+
+		// Transactions
+		TransactionMaxAmount: getMoney("TRANSACTION_MAX_AMOUNT", models.Rupiah(1000000000)),
+
+		// Brute-force protection
+		AccountMaxAttempts: getInt("ACCOUNT_MAX_ATTEMPTS", 5),
+		IPMaxAttempts:      getInt("IP_MAX_ATTEMPTS", 20),
+		OTPMaxAttempts:     getInt("OTP_MAX_ATTEMPTS", 5),
+		LockoutBase:        getDuration("LOCKOUT_BASE", time.Minute),
+		LockoutMax:         getDuration("LOCKOUT_MAX", time.Hour),
+		ThrottleWindow:     getDuration("THROTTLE_WINDOW", time.Hour),
+
+		// Password reset
+		ResetTokenTTL: getDuration("RESET_TOKEN_TTL", 10*time.Minute),
+		CodeHashKey:   getEnv("CODE_HASH_KEY", ""),
+
+		// Password policy
+		PasswordMinLength: getInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordClasses:   getList("PASSWORD_CLASSES", []string{"letter", "digit"}),
+		PasswordHistory:   getInt("PASSWORD_HISTORY", 5),
+		PasswordBreachDir: getEnv("PASSWORD_BREACH_DIR", ""),
+
+		// Password hashing
+		PasswordHashAlg: strings.ToLower(getEnv("PASSWORD_HASH_ALG", "argon2id")),
+		BcryptCost:      getInt("BCRYPT_COST", 10),
+		Argon2Memory:    getInt("ARGON2_MEMORY_KB", 19456),
+		Argon2Time:      getInt("ARGON2_TIME", 2),
+		Argon2Threads:   getInt("ARGON2_THREADS", 1),
+
+		// Passwordless login
+		MagicLinkTTL: getDuration("MAGIC_LINK_TTL", 10*time.Minute),
+		MagicLinkURL: getEnv("MAGIC_LINK_URL", ""),
+
+		// Login alerts
+		LoginAlerts:   getEnv("LOGIN_ALERTS", "true") == "true",
+		LoginAlertTTL: getDuration("LOGIN_ALERT_TTL", 7*24*time.Hour),
+		LoginAlertURL: getEnv("LOGIN_ALERT_URL", ""),
+
+		// E-mail verification
+		AppBaseURL:           getEnv("APP_BASE_URL", ""),
+		RequireVerifiedEmail: getEnv("REQUIRE_VERIFIED_EMAIL", "true") == "true",
+
+		// Account deletion
+		AccountDeletionGrace: getDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour),
+		PurgeInterval:        getDuration("PURGE_INTERVAL", time.Hour),
+
+		// Admin bootstrap
+		AdminEmails: getList("ADMIN_EMAILS", nil),
+
+		// OpenID Connect provider
+		OIDCConsentURL: getEnv("OIDC_CONSENT_URL", ""),
+		Connectors:     loadConnectors(),
 
 		// SMTP Settings
 		MailServer:        getEnv("MAIL_SERVER", "smtp.gmail.com"),
@@ -42,9 +240,73 @@ func Load() *Config {
 	}
 }
 
+// loadConnectors reads OIDC_CONNECTORS=google,... and, for each id, the
+// OIDC_<ID>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL, _NAME and
+// _SCOPES variables.
+func loadConnectors() []ConnectorConfig {
+	var out []ConnectorConfig
+	for _, id := range getList("OIDC_CONNECTORS", nil) {
+		id = strings.ToLower(id)
+		prefix := "OIDC_" + strings.ToUpper(id) + "_"
+		out = append(out, ConnectorConfig{
+			ID:           id,
+			Name:         getEnv(prefix+"NAME", id),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       getList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		})
+	}
+	return out
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
 	return def
 }
+
+// getDuration parses values like "15m" or "720h"; invalid values fall back to def.
+func getDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func getInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// getMoney reads an amount of rupiah, e.g. 5000000 or 12500.50.
+func getMoney(key string, def models.Money) models.Money {
+	if v := os.Getenv(key); v != "" {
+		if m, err := models.ParseMoney(v); err == nil {
+			return m
+		}
+	}
+	return def
+}
+
+// getList splits a comma separated value, dropping empty items.
+func getList(key string, def []string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return def
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+// Package connectors lets users log in with an upstream identity provider
+// (Google, another OpenID Connect provider, ...) instead of a password.
+package connectors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"autentikasi/config"
+)
+
+// Identity is what an upstream provider asserts about the user.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Connector is one upstream identity provider.
+type Connector interface {
+	// ID is the stable name used in routes and stored with linked identities.
+	ID() string
+	// Name is shown to users, e.g. "Google".
+	Name() string
+	// AuthCodeURL is where the user is sent to log in upstream.
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	// Exchange redeems the code returned upstream and verifies the identity.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Connector{}
+)
+
+// Register makes c available to the login endpoints, replacing any
+// connector with the same id.
+func Register(c Connector) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[c.ID()] = c
+}
+
+// Get returns the connector with the given id.
+func Get(id string) (Connector, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := registry[id]
+	return c, ok
+}
+
+// List returns every registered connector, sorted by id.
+func List() []Connector {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]Connector, 0, len(registry))
+	for _, c := range registry {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID() < out[j].ID() })
+	return out
+}
+
+// Init registers an OIDC connector for every entry of cfg.Connectors.
+func Init(cfg *config.Config) error {
+	for _, cc := range cfg.Connectors {
+		if cc.Issuer == "" || cc.ClientID == "" || cc.RedirectURL == "" {
+			return fmt.Errorf("connector %q: issuer, client id and redirect URL are required", cc.ID)
+		}
+		Register(NewOIDC(cc))
+	}
+	return nil
+}
+
+// CanLinkByEmail reports whether a login with an upstream identity that is
+// not linked yet may be linked to the local account with the same e-mail.
+// Only when both sides proved ownership of the address; otherwise whoever
+// registered it first could take over the account.
+func CanLinkByEmail(id *Identity, localVerified bool) bool {
+	return id.Email != "" && id.EmailVerified && localVerified
+}
+
+// CanUnlink reports whether one of the linked identities of an account may
+// be removed. The last login method of an account without a password stays.
+func CanUnlink(hasPassword bool, linked int64) bool {
+	return hasPassword || linked > 1
+}
@@ -0,0 +1,163 @@
+package connectors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"autentikasi/connectors/internal/mockoidc"
+)
+
+const testRedirect = "http://app.test/auth/callback/mock"
+
+func newMock(t *testing.T) (*mockoidc.Server, *OIDC) {
+	t.Helper()
+	srv, err := mockoidc.New("dompetku-test", "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv, NewOIDC(srv.ConnectorConfig("mock", testRedirect))
+}
+
+// login runs the authorization code flow up to the exchange, as the login
+// handlers do: the code comes from the provider's redirect, the verifier
+// and nonce from the start of the flow.
+func login(t *testing.T, conn *OIDC, verifier, nonce string) (*Identity, error) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(goodVerifier))
+	authURL := conn.AuthCodeURL("state-1", "nonce-1", base64.RawURLEncoding.EncodeToString(sum[:]))
+	if authURL == "" {
+		t.Fatal("AuthCodeURL failed")
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), testRedirect) {
+		t.Fatalf("redirect to %q", resp.Header.Get("Location"))
+	}
+	if loc.Query().Get("state") != "state-1" {
+		t.Fatalf("state = %q", loc.Query().Get("state"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return conn.Exchange(ctx, loc.Query().Get("code"), verifier, nonce)
+}
+
+const goodVerifier = "verifier-0123456789"
+
+func TestLogin(t *testing.T) {
+	srv, conn := newMock(t)
+	srv.SetIdentity(mockoidc.Identity{Subject: "u-1", Email: " Budi@Example.com ", EmailVerified: true, Name: "Budi"})
+
+	id, err := login(t, conn, goodVerifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "u-1", Email: "budi@example.com", EmailVerified: true, Name: "Budi"}
+	if *id != want {
+		t.Fatalf("identity = %+v, want %+v", *id, want)
+	}
+}
+
+func TestLinkByVerifiedEmail(t *testing.T) {
+	srv, conn := newMock(t)
+	srv.SetIdentity(mockoidc.Identity{Subject: "u-2", Email: "siti@example.com", EmailVerified: true})
+
+	id, err := login(t, conn, goodVerifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CanLinkByEmail(id, true) {
+		t.Error("verified identity not linked to a verified account")
+	}
+	if CanLinkByEmail(id, false) {
+		t.Error("verified identity linked to an account whose e-mail is unverified")
+	}
+}
+
+func TestRefuseUnverifiedEmail(t *testing.T) {
+	srv, conn := newMock(t)
+	srv.SetIdentity(mockoidc.Identity{Subject: "u-3", Email: "siti@example.com", EmailVerified: false})
+
+	id, err := login(t, conn, goodVerifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.EmailVerified {
+		t.Fatal("email_verified=false reported as verified")
+	}
+	if CanLinkByEmail(id, true) {
+		t.Error("unverified identity linked to an existing account")
+	}
+
+	// Some providers send email_verified as a string.
+	srv.SetClaims(map[string]interface{}{"email_verified": "false"})
+	if id, err = login(t, conn, goodVerifier, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+	if id.EmailVerified {
+		t.Error(`email_verified="false" reported as verified`)
+	}
+	if CanLinkByEmail(&Identity{Subject: "u-4", EmailVerified: true}, true) {
+		t.Error("identity without e-mail linked")
+	}
+}
+
+func TestCanUnlink(t *testing.T) {
+	tests := []struct {
+		hasPassword bool
+		linked      int64
+		want        bool
+	}{
+		{true, 1, true},
+		{true, 2, true},
+		{false, 2, true},
+		{false, 1, false}, // the only way left to log in
+		{false, 0, false},
+	}
+	for _, tt := range tests {
+		if got := CanUnlink(tt.hasPassword, tt.linked); got != tt.want {
+			t.Errorf("CanUnlink(%v, %d) = %v, want %v", tt.hasPassword, tt.linked, got, tt.want)
+		}
+	}
+}
+
+func TestRejectBadIDToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		nonce    string
+		verifier string
+	}{
+		{name: "nonce of another flow", nonce: "nonce-2"},
+		{name: "replayed nonce", claims: map[string]interface{}{"nonce": "nonce-0"}, nonce: "nonce-1"},
+		{name: "other audience", claims: map[string]interface{}{"aud": "another-client"}, nonce: "nonce-1"},
+		{name: "other issuer", claims: map[string]interface{}{"iss": "https://evil.test"}, nonce: "nonce-1"},
+		{name: "expired", claims: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, nonce: "nonce-1"},
+		{name: "no subject", claims: map[string]interface{}{"sub": ""}, nonce: "nonce-1"},
+		{name: "wrong PKCE verifier", nonce: "nonce-1", verifier: "verifier-other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, conn := newMock(t)
+			srv.SetClaims(tt.claims)
+			verifier := tt.verifier
+			if verifier == "" {
+				verifier = goodVerifier
+			}
+			if id, err := login(t, conn, verifier, tt.nonce); err == nil {
+				t.Fatalf("accepted: %+v", *id)
+			}
+		})
+	}
+}
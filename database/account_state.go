@@ -0,0 +1,41 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"autentikasi/models"
+)
+
+// migrateAccountStates moves the flags that account_state replaces
+// (disabled_at/disabled_reason, password_reset_required and
+// deletion_requested_at) into it. Each flag is cleared in the statement
+// that moves it, so the migration can run at every start: a flag is moved
+// once, and a later state change is never overwritten by an old flag. The
+// columns are kept; the time and reason of a moved flag are in
+// state_changed_at and state_reason. added says account_state was just
+// created and still has its default everywhere.
+func migrateAccountStates(db *gorm.DB, added bool) error {
+	m := db.Migrator()
+	var steps []string
+	if added {
+		steps = append(steps, "UPDATE users SET account_state = 'unverified' WHERE email_verified_at IS NULL")
+	}
+	// Later steps win: suspended over locked over pending_deletion.
+	if m.HasColumn(&models.User{}, "deletion_requested_at") {
+		steps = append(steps, "UPDATE users SET account_state = 'pending_deletion', state_changed_at = deletion_requested_at, state_reason = 'requested by user', deletion_requested_at = NULL WHERE deletion_requested_at IS NOT NULL AND deletion_scheduled_at IS NOT NULL")
+	}
+	if m.HasColumn(&models.User{}, "password_reset_required") {
+		steps = append(steps, "UPDATE users SET account_state = 'locked', state_changed_at = NOW(), state_reason = 'password reset required', password_reset_required = 0 WHERE password_reset_required = 1")
+	}
+	if m.HasColumn(&models.User{}, "disabled_at") {
+		steps = append(steps, "UPDATE users SET account_state = 'suspended', state_changed_at = disabled_at, state_reason = COALESCE(disabled_reason, ''), disabled_at = NULL WHERE disabled_at IS NOT NULL")
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, sql := range steps {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -22,7 +22,74 @@ func Connect(cfg *config.Config) error {
 		return err
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.Transaction{}, &models.Friendship{}, &models.PasswordReset{}, &models.AccountHistory{}); err != nil {
+	hadVerifiedColumn := db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+	hadStateColumn := db.Migrator().HasColumn(&models.User{}, "account_state")
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Transaction{},
+		&models.Friendship{},
+		&models.PasswordReset{},
+		&models.AccountHistory{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RecoveryCode{},
+		&models.AuthThrottle{},
+		&models.VerificationCode{},
+		&models.RevokedToken{},
+		&models.APIKey{},
+		&models.Permission{},
+		&models.Role{},
+		&models.AdminAudit{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorization{},
+		&models.OAuthConsent{},
+		&models.ExternalIdentity{},
+		&models.ConnectorState{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.PasswordHistory{},
+		&models.KnownDevice{},
+	); err != nil {
+		return err
+	}
+
+	// Accounts created before e-mail verification existed are treated as verified.
+	if !hadVerifiedColumn {
+		if err := db.Exec("UPDATE users SET email_verified_at = COALESCE(created_at, NOW()) WHERE email_verified_at IS NULL").Error; err != nil {
+			return err
+		}
+	}
+
+	// password_resets used to keep the OTP in plaintext; the hash now lives in
+	// otp_hash. Outstanding plaintext codes are simply dropped.
+	if db.Migrator().HasColumn(&models.PasswordReset{}, "otp") {
+		if err := db.Migrator().DropColumn(&models.PasswordReset{}, "otp"); err != nil {
+			return err
+		}
+		db.Where("otp_hash = ''").Delete(&models.PasswordReset{})
+	}
+
+	// transactions.jumlah used to be a DOUBLE of rupiah; amounts are now
+	// kept in jumlah_sen.
+	if db.Migrator().HasColumn(&models.Transaction{}, "jumlah") {
+		if err := migrateTransactionAmounts(db); err != nil {
+			return err
+		}
+	}
+
+	if err := migrateAccountStates(db, !hadStateColumn); err != nil {
+		return err
+	}
+
+	if err := scheduleLegacyDeletions(db, cfg.AccountDeletionGrace); err != nil {
+		return err
+	}
+
+	if err := seedRoles(db); err != nil {
+		return err
+	}
+	if err := grantAdmins(db, cfg.AdminEmails); err != nil {
 		return err
 	}
 
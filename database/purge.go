@@ -0,0 +1,131 @@
+package database
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"autentikasi/models"
+)
+
+// userTables are removed row by row when an account is purged; they only
+// hold data about the user_id they belong to.
+var userTables = []interface{}{
+	&models.Transaction{},
+	&models.AccountHistory{},
+	&models.Session{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.RecoveryCode{},
+	&models.AuthThrottle{},
+	&models.VerificationCode{},
+	&models.APIKey{},
+	&models.OAuthAuthorization{},
+	&models.OAuthConsent{},
+	&models.ExternalIdentity{},
+	&models.ConnectorState{},
+	&models.WebAuthnCredential{},
+	&models.WebAuthnChallenge{},
+	&models.PasswordHistory{},
+	&models.KnownDevice{},
+}
+
+// PurgeUser permanently removes an account and everything stored about it.
+// Friendships are removed from both sides; admin audit entries keep only the
+// numeric ID. The row is hard-deleted so the e-mail address can be used
+// again.
+func PurgeUser(userID uint64) error {
+	var user models.User
+	if err := DB.Unscoped().First(&user, userID).Error; err != nil {
+		return err
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range userTables {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("user_id = ? OR friend_id = ?", userID, userID).Delete(&models.Friendship{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("email = ?", user.Email).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("`key` IN ?", models.EmailThrottleKeys(user.Email)).Delete(&models.AuthThrottle{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.User{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if user.ImgURL != nil && *user.ImgURL != "" {
+		path := filepath.Join("uploads", filepath.Base(*user.ImgURL))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Purge] failed to remove avatar %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// scheduleLegacyDeletions gives rows soft-deleted before account deletion
+// existed a deletion date one grace period from now. Without it they would
+// keep their e-mail address taken forever; purging them at once would leave
+// no time to notice a mistake.
+func scheduleLegacyDeletions(db *gorm.DB, grace time.Duration) error {
+	return db.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deletion_scheduled_at IS NULL").
+		UpdateColumn("deletion_scheduled_at", time.Now().Add(grace)).Error
+}
+
+// PurgeDueAccounts purges accounts whose deletion grace period is over,
+// including soft-deleted rows scheduled by scheduleLegacyDeletions.
+func PurgeDueAccounts() (int, error) {
+	var ids []uint64
+	if err := DB.Unscoped().Model(&models.User{}).
+		Where("deletion_scheduled_at <= ? AND (account_state = ? OR deleted_at IS NOT NULL)", time.Now(), models.AccountPendingDeletion).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, id := range ids {
+		// The user may have cancelled since the query above.
+		var user models.User
+		if err := DB.Unscoped().First(&user, id).Error; err != nil {
+			continue
+		}
+		if !user.DueForPurge(time.Now()) {
+			continue
+		}
+		if err := PurgeUser(id); err != nil {
+			log.Printf("[Purge] failed to purge user %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartPurgeJob runs PurgeDueAccounts now and then every interval.
+func StartPurgeJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if n, err := PurgeDueAccounts(); err != nil {
+				log.Printf("[Purge] %v", err)
+			} else if n > 0 {
+				log.Printf("[Purge] purged %d account(s)", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
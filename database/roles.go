@@ -0,0 +1,58 @@
+package database
+
+import (
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"autentikasi/models"
+)
+
+// seedRoles creates the built-in roles and permissions and makes sure each
+// built-in role has its default permissions. Extra permissions granted by
+// hand are left alone.
+func seedRoles(db *gorm.DB) error {
+	for name, perms := range models.DefaultRoles {
+		role := models.Role{Name: name}
+		if err := db.Where(models.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		for _, p := range perms {
+			perm := models.Permission{Name: p}
+			if err := db.Where(models.Permission{Name: p}).FirstOrCreate(&perm).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&role).Association("Permissions").Append(&perm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// grantAdmins gives the admin role to the listed e-mail addresses. It is how
+// the first admin is created; accounts that do not exist yet are skipped.
+func grantAdmins(db *gorm.DB, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	var role models.Role
+	if err := db.Where("name = ?", models.RoleAdmin).First(&role).Error; err != nil {
+		return err
+	}
+	for i, e := range emails {
+		emails[i] = strings.ToLower(e)
+	}
+	var users []models.User
+	if err := db.Where("email IN ?", emails).Find(&users).Error; err != nil {
+		return err
+	}
+	for i := range users {
+		if err := db.Model(&users[i]).Association("Roles").Append(&role); err != nil {
+			return err
+		}
+		log.Printf("[DB] admin role granted to %s", users[i].Email)
+	}
+	return nil
+}
@@ -36,10 +36,12 @@ func SeedDev() error {
 
 	// create dev user
 	passHash, _ := utils.Hash("password")
+	verifiedAt := time.Now()
 	u := models.User{
-		Nama:     "Dev User",
-		Email:    "dev@example.com",
-		Password: passHash,
+		Nama:            "Dev User",
+		Email:           "dev@example.com",
+		Password:        passHash,
+		EmailVerifiedAt: &verifiedAt,
 	}
 	if err := DB.Create(&u).Error; err != nil {
 		log.Printf("[SEED] failed to create dev user: %v", err)
@@ -53,7 +55,7 @@ func SeedDev() error {
 		{
 			UserID:     u.ID,
 			Jenis:      "pemasukan",
-			Jumlah:     4500000,
+			Jumlah:     models.Rupiah(4500000),
 			Metode:     "Transfer",
 			Keterangan: "Gaji Bulanan",
 			CreatedAt:  &now,
@@ -61,7 +63,7 @@ func SeedDev() error {
 		{
 			UserID:     u.ID,
 			Jenis:      "pengeluaran",
-			Jumlah:     20000,
+			Jumlah:     models.Rupiah(20000),
 			Metode:     "Tunai",
 			Keterangan: "Makan Soto",
 			CreatedAt:  &now,
@@ -69,7 +71,7 @@ func SeedDev() error {
 		{
 			UserID:     u.ID,
 			Jenis:      "pengeluaran",
-			Jumlah:     12000,
+			Jumlah:     models.Rupiah(12000),
 			Metode:     "Tunai",
 			Keterangan: "BBM motor",
 			CreatedAt:  &now,
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"autentikasi/models"
+)
+
+// migrateTransactionAmounts fills jumlah_sen from the old floating-point
+// jumlah column and then drops it. Values are converted with
+// models.MoneyFromFloat: the decimal the user saw, rounded to the sen half
+// away from zero. Deleted transactions are converted too.
+func migrateTransactionAmounts(db *gorm.DB) error {
+	var amounts []float64
+	if err := db.Table("transactions").Distinct("jumlah").Pluck("jumlah", &amounts).Error; err != nil {
+		return err
+	}
+	converted, err := amountsInSen(amounts)
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, f := range amounts {
+			// Each value is compared with itself, as stored; no float
+			// arithmetic happens in the query.
+			if err := tx.Exec("UPDATE transactions SET jumlah_sen = ? WHERE jumlah = ?", converted[f], f).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.Migrator().DropColumn(&models.Transaction{}, "jumlah"); err != nil {
+		return err
+	}
+	log.Printf("[DB] converted %d distinct transaction amount(s) to sen", len(amounts))
+	return nil
+}
+
+// amountsInSen converts the distinct float amounts of the old column. It
+// fails on the first amount that does not fit, before anything is written.
+func amountsInSen(amounts []float64) (map[float64]models.Money, error) {
+	out := make(map[float64]models.Money, len(amounts))
+	for _, f := range amounts {
+		sen, err := models.MoneyFromFloat(f)
+		if err != nil {
+			return nil, fmt.Errorf("transaction amount %v: %w", f, err)
+		}
+		out[f] = sen
+	}
+	return out, nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"math"
+	"testing"
+
+	"autentikasi/models"
+)
+
+func TestAmountsInSen(t *testing.T) {
+	// Distinct values as the old DOUBLE column returns them.
+	amounts := []float64{4500000, 20000, 0.1 + 0.2, 1.005, 12.345, -0.125}
+	got, err := amountsInSen(amounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[float64]models.Money{
+		4500000:   450000000,
+		20000:     2000000,
+		0.1 + 0.2: 30,
+		1.005:     101,
+		12.345:    1235,
+		-0.125:    -13,
+	}
+	for f, sen := range want {
+		if got[f] != sen {
+			t.Errorf("%v -> %d, want %d", f, got[f], sen)
+		}
+	}
+
+	// One amount out of range stops the whole migration.
+	if _, err := amountsInSen([]float64{1, math.MaxFloat64}); err == nil {
+		t.Error("out of range amount converted")
+	}
+}
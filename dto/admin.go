@@ -0,0 +1,14 @@
+package dto
+
+type DisableUserRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type SetAccountStateRequest struct {
+	State  string `json:"state" validate:"required"`
+	Reason string `json:"reason"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
@@ -3,14 +3,16 @@ package dto
 type RegisterRequest struct {
 	Nama     string `json:"nama" validate:"required,min=2"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
 	Pin      string `json:"pin,omitempty" validate:"required,min=4,max=6"`
 	ImgURL   string `json:"img_url,omitempty"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required"`
+	DeviceName string `json:"device_name,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
 }
 
 type ForgotPasswordRequest struct {
@@ -23,7 +25,88 @@ type VerifyOTPRequest struct {
 }
 
 type ResetPasswordRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	OTP      string `json:"otp" validate:"required,len=6"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email      string `json:"email" validate:"required,email"`
+	ResetToken string `json:"reset_token" validate:"required"`
+	Password   string `json:"password" validate:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type SetPinRequest struct {
+	Password string `json:"password" validate:"required"`
+	Pin      string `json:"pin" validate:"required,min=4,max=6"`
+}
+
+type ChangePinRequest struct {
+	CurrentPin string `json:"current_pin" validate:"required"`
+	Pin        string `json:"pin" validate:"required,min=4,max=6"`
+}
+
+type VerifyPinRequest struct {
+	Pin string `json:"pin" validate:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Email string `json:"email,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+type ReportLoginRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+type RevokeTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 = never expires
+}
+
+type ConnectorStartRequest struct {
+	ClientID   string `json:"client_id,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+type ConnectorCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkVerifyRequest takes either the e-mailed token or email + code.
+type MagicLinkVerifyRequest struct {
+	Email      string `json:"email,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Token      string `json:"token,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+}
+
+// DeleteAccountRequest confirms the deletion with the password, or with the
+// PIN for accounts that have no password.
+type DeleteAccountRequest struct {
+	Password string `json:"password,omitempty"`
+	Pin      string `json:"pin,omitempty"`
 }
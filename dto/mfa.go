@@ -0,0 +1,27 @@
+package dto
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+type DisableTOTPRequest struct {
+	Password     string              `json:"password" validate:"required"`
+	Code         string              `json:"code,omitempty"`
+	RecoveryCode string              `json:"recovery_code,omitempty"`
+	Credential   *WebAuthnCredential `json:"credential,omitempty"`
+}
+
+// RecoveryCodesRequest confirms the change with a TOTP code or a passkey.
+type RecoveryCodesRequest struct {
+	Code       string              `json:"code,omitempty"`
+	Credential *WebAuthnCredential `json:"credential,omitempty"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string              `json:"mfa_token" validate:"required"`
+	Code         string              `json:"code,omitempty"`
+	RecoveryCode string              `json:"recovery_code,omitempty"`
+	Credential   *WebAuthnCredential `json:"credential,omitempty"` // passkey assertion
+	DeviceName   string              `json:"device_name,omitempty"`
+	ClientID     string              `json:"client_id,omitempty"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+// OAuthTokenRequest is the form body of POST /oauth/token. Client
+// credentials may also come in an HTTP Basic Authorization header.
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type" json:"grant_type"`
+	Code         string `form:"code" json:"code"`
+	RedirectURI  string `form:"redirect_uri" json:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier" json:"code_verifier"`
+	RefreshToken string `form:"refresh_token" json:"refresh_token"`
+	ClientID     string `form:"client_id" json:"client_id"`
+	ClientSecret string `form:"client_secret" json:"client_secret"`
+}
+
+type OAuthConsentRequest struct {
+	Approve bool `json:"approve"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required"`
+	Public       bool     `json:"public"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "autentikasi/models"
+
+// TransactionRequest is the body of POST /transactions and PUT
+// /transactions/:id: the whole transaction.
+type TransactionRequest struct {
+	Jenis      string       `json:"jenis" validate:"required"`
+	Jumlah     models.Money `json:"jumlah" validate:"required"`
+	Metode     string       `json:"metode"`
+	Kategori   string       `json:"kategori"`
+	Keterangan string       `json:"keterangan"`
+}
+
+// PatchTransactionRequest is the body of PATCH /transactions/:id: only the
+// fields that are sent change.
+type PatchTransactionRequest struct {
+	Jenis      *string       `json:"jenis"`
+	Jumlah     *models.Money `json:"jumlah"`
+	Metode     *string       `json:"metode"`
+	Kategori   *string       `json:"kategori"`
+	Keterangan *string       `json:"keterangan"`
+}
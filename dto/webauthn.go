@@ -0,0 +1,43 @@
+package dto
+
+// WebAuthnCredential is a PublicKeyCredential as serialized by the browser,
+// with every binary field base64url encoded (the PublicKeyCredential.toJSON()
+// format).
+type WebAuthnCredential struct {
+	ID       string                     `json:"id"`
+	RawID    string                     `json:"rawId"`
+	Type     string                     `json:"type"`
+	Response WebAuthnCredentialResponse `json:"response"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"` // registration
+	AuthenticatorData string   `json:"authenticatorData,omitempty"` // login
+	Signature         string   `json:"signature,omitempty"`         // login
+	UserHandle        string   `json:"userHandle,omitempty"`        // login
+	Transports        []string `json:"transports,omitempty"`
+}
+
+type PasskeyRegisterFinishRequest struct {
+	Name       string             `json:"name,omitempty"`
+	Credential WebAuthnCredential `json:"credential" validate:"required"`
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type PasskeyLoginBeginRequest struct {
+	Email string `json:"email,omitempty"`
+}
+
+type PasskeyLoginFinishRequest struct {
+	Credential WebAuthnCredential `json:"credential" validate:"required"`
+	DeviceName string             `json:"device_name,omitempty"`
+	ClientID   string             `json:"client_id,omitempty"`
+}
+
+type PasskeyMFABeginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
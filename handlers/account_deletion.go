@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// exportProfile is the account as shown in an export: everything the user
+// entered, without secrets.
+func exportProfile(user *models.User) fiber.Map {
+	return fiber.Map{
+		"id":                user.ID,
+		"nama":              user.Nama,
+		"email":             user.Email,
+		"email_verified_at": user.EmailVerifiedAt,
+		"phone":             user.Phone,
+		"gender":            user.Gender,
+		"birthday":          user.Birthday,
+		"status":            user.Status,
+		"account_state":     user.AccountState,
+		"img":               user.ImgURL,
+		"has_password":      user.Password != "",
+		"has_pin":           user.Pin != nil && *user.Pin != "",
+		"mfa_enabled":       user.MFAEnabled(),
+		"created_at":        user.CreatedAt,
+		"updated_at":        user.UpdatedAt,
+	}
+}
+
+// ExportData - download everything stored about the current user: a ZIP of
+// JSON files, or a single JSON document with ?format=json
+// GET /api/v1/me/export
+func ExportData(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var (
+		transactions []models.Transaction
+		friendships  []models.Friendship
+		history      []models.AccountHistory
+		sessions     []models.Session
+		apiKeys      []models.APIKey
+		identities   []models.ExternalIdentity
+		passkeys     []models.WebAuthnCredential
+		consents     []models.OAuthConsent
+		devices      []models.KnownDevice
+	)
+	db := database.DB
+	queries := []error{
+		db.Where("user_id = ?", user.ID).Order("id").Find(&transactions).Error,
+		db.Where("user_id = ? OR friend_id = ?", user.ID, user.ID).Order("id").Find(&friendships).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&history).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&sessions).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&apiKeys).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&identities).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&passkeys).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&consents).Error,
+		db.Where("user_id = ?", user.ID).Order("id").Find(&devices).Error,
+	}
+	for _, err := range queries {
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to export data")
+		}
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", exportProfile(user)},
+		{"transactions.json", transactions},
+		{"friendships.json", friendships},
+		{"account_history.json", history},
+		{"sessions.json", sessions},
+		{"api_keys.json", apiKeys},
+		{"linked_accounts.json", identities},
+		{"passkeys.json", passkeys},
+		{"oauth_consents.json", consents},
+		{"known_devices.json", devices},
+	}
+	recordEvent(c, user.ID, "data_export", "Account data exported", nil)
+	stamp := time.Now().Format("20060102")
+	base := "dompetku-export-" + strconv.FormatUint(user.ID, 10) + "-" + stamp
+
+	if c.Query("format") == "json" {
+		doc := fiber.Map{"exported_at": time.Now()}
+		for _, f := range files {
+			doc[f.name[:len(f.name)-len(".json")]] = f.data
+		}
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+base+`.json"`)
+		return c.Status(fiber.StatusOK).JSON(doc)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to export data")
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to export data")
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to export data")
+	}
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+base+`.zip"`)
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
+
+// DeleteAccount - schedule the account for deletion after the grace period.
+// Requires the password (or the PIN when the account has no password).
+// Other devices are logged out and API keys stop working; logging in again
+// before the deadline lets the user cancel.
+// DELETE /api/v1/me
+func DeleteAccount(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if user.PendingDeletion() {
+		return utils.Fail(c, fiber.StatusConflict, "Akun sudah dijadwalkan untuk dihapus")
+	}
+
+	var body dto.DeleteAccountRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	switch {
+	case user.Password != "":
+		if ok, err := verifyPassword(c, user, body.Password, "Kata sandi kamu salah"); !ok {
+			return err
+		}
+	case user.Pin != nil && *user.Pin != "":
+		if err := checkPin(user, body.Pin); err != nil {
+			return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+		}
+	default:
+		return utils.Fail(c, fiber.StatusBadRequest, "Atur kata sandi lewat lupa kata sandi sebelum menghapus akun")
+	}
+
+	cfg := c.Locals("config").(*config.Config)
+	now := time.Now()
+	purgeAt := now.Add(cfg.AccountDeletionGrace)
+	err := setAccountState(c, user, models.AccountPendingDeletion, "requested by user, purge after "+purgeAt.Format(time.RFC3339), map[string]interface{}{
+		"deletion_scheduled_at": purgeAt,
+	})
+	if errors.Is(err, errStateTransition) {
+		return utils.Fail(c, fiber.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal menghapus akun")
+	}
+	user.DeletionScheduledAt = &purgeAt
+
+	var keepID uint64
+	if sess, ok := c.Locals("session").(*models.Session); ok && sess != nil {
+		keepID = sess.ID
+	}
+	if _, err := revokeUserSessions(user.ID, keepID, "account_deletion"); err != nil {
+		log.Printf("[DeleteAccount] Failed to revoke sessions: %v", err)
+	}
+	database.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now)
+
+	go func(cfg *config.Config, email string, purgeAt time.Time) {
+		if err := utils.SendAccountDeletionEmail(cfg, email, purgeAt); err != nil {
+			log.Printf("[DeleteAccount] Failed to send email (async): %v", err)
+		}
+	}(cfg, user.Email, purgeAt)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"message":               "Account scheduled for deletion",
+		"deletion_scheduled_at": purgeAt,
+	})
+}
+
+// CancelAccountDeletion - keep the account after all
+// POST /api/v1/me/deletion/cancel
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if !user.PendingDeletion() {
+		return utils.Fail(c, fiber.StatusBadRequest, "Akun tidak dijadwalkan untuk dihapus")
+	}
+	err := setAccountState(c, user, user.UsableState(), "deletion cancelled by user", map[string]interface{}{
+		"deletion_scheduled_at": nil,
+	})
+	if errors.Is(err, errStateTransition) {
+		return utils.Fail(c, fiber.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membatalkan penghapusan akun")
+	}
+	user.DeletionScheduledAt = nil
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Account deletion cancelled"})
+}
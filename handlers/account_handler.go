@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const emailChangeTTL = 30 * time.Minute
+
+// ChangePassword - change the password of the logged-in user; every other
+// session is logged out
+// POST /api/v1/me/password
+func ChangePassword(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.ChangePasswordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+
+	if ok, err := verifyPassword(c, user, body.CurrentPassword, "Kata sandi saat ini salah"); !ok {
+		return err
+	}
+
+	if body.NewPassword == body.CurrentPassword {
+		return utils.Fail(c, fiber.StatusBadRequest, "Kata sandi baru harus berbeda")
+	}
+	cfg := c.Locals("config").(*config.Config)
+	if perr := checkNewPassword(cfg, user, body.NewPassword); perr != nil {
+		return passwordRejected(c, perr)
+	}
+
+	hashPass, err := utils.Hash(body.NewPassword)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal mengubah kata sandi")
+	}
+	if err := database.DB.Model(user).Update("password", hashPass).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal mengubah kata sandi")
+	}
+	savePasswordHistory(cfg, user.ID, hashPass)
+
+	var keepID uint64
+	if sess, ok := c.Locals("session").(*models.Session); ok && sess != nil {
+		keepID = sess.ID
+	}
+	if _, err := revokeUserSessions(user.ID, keepID, "password_change"); err != nil {
+		log.Printf("[ChangePassword] Failed to revoke sessions: %v", err)
+	}
+	recordEvent(c, user.ID, "password_change", "Password changed by user", nil)
+
+	go func(cfg *config.Config, email string) {
+		if err := utils.SendPasswordChangedEmail(cfg, email); err != nil {
+			log.Printf("[ChangePassword] Failed to send email (async): %v", err)
+		}
+	}(cfg, user.Email)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Password changed"})
+}
+
+// RequestEmailChange - Step 1: send a confirmation code to the new address
+// POST /api/v1/me/email
+func RequestEmailChange(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.ChangeEmailRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	newEmail := strings.TrimSpace(strings.ToLower(body.NewEmail))
+	if !validEmail(newEmail) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Format e-mail tidak valid")
+	}
+	if newEmail == user.Email {
+		return utils.Fail(c, fiber.StatusBadRequest, "E-mail baru sama dengan e-mail saat ini")
+	}
+	var exists int64
+	database.DB.Model(&models.User{}).Where("email = ?", newEmail).Count(&exists)
+	if exists > 0 {
+		return utils.Fail(c, fiber.StatusConflict, "E-mail sudah terdaftar")
+	}
+
+	code, _, err := issueVerificationCode(user.ID, models.PurposeEmailChange, newEmail, emailChangeTTL)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat kode konfirmasi")
+	}
+
+	cfg := c.Locals("config").(*config.Config)
+	go func(cfg *config.Config, email, code string) {
+		if err := utils.SendEmailChangeCode(cfg, email, code); err != nil {
+			log.Printf("[EmailChange] Failed to send email (async): %v", err)
+		}
+	}(cfg, newEmail, code)
+	recordEvent(c, user.ID, "email_change_requested", "E-mail change to "+newEmail+" requested", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"new_email":  newEmail,
+		"expires_in": int64(emailChangeTTL.Seconds()),
+	})
+}
+
+// ConfirmEmailChange - Step 2: switch to the new address with the code that
+// was sent to it; the old address gets a notice
+// POST /api/v1/me/email/confirm
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.ConfirmEmailChangeRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if strings.TrimSpace(body.Code) == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "Kode konfirmasi wajib diisi")
+	}
+
+	vc, err := consumeVerificationCode(models.PurposeEmailChange, user.ID, "", strings.TrimSpace(body.Code), "")
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var exists int64
+	database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", vc.Email, user.ID).Count(&exists)
+	if exists > 0 {
+		return utils.Fail(c, fiber.StatusConflict, "E-mail sudah terdaftar")
+	}
+
+	oldEmail := user.Email
+	now := time.Now()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"email":             vc.Email,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal mengganti e-mail")
+	}
+	recordEvent(c, user.ID, "email_change", "E-mail changed from "+oldEmail+" to "+vc.Email, nil)
+	activateVerified(c, user)
+
+	cfg := c.Locals("config").(*config.Config)
+	go func(cfg *config.Config, oldEmail, newEmail string) {
+		if err := utils.SendEmailChangedNotice(cfg, oldEmail, newEmail); err != nil {
+			log.Printf("[EmailChange] Failed to send notice (async): %v", err)
+		}
+	}(cfg, oldEmail, vc.Email)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "E-mail changed", "email": vc.Email})
+}
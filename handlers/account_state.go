@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/database"
+	"autentikasi/models"
+)
+
+var errStateTransition = errors.New("Perubahan status akun tidak diizinkan")
+
+// setAccountState moves the account to another state, together with any
+// extra columns that belong to the change. The update only applies while the
+// account is still in the state the caller saw, so two concurrent changes
+// cannot both win.
+func setAccountState(c *fiber.Ctx, user *models.User, to, reason string, extra map[string]interface{}) error {
+	from := user.AccountState
+	if !models.CanTransition(from, to) {
+		return errStateTransition
+	}
+	now := time.Now()
+	reason = truncate(reason, 255)
+	updates := map[string]interface{}{
+		"account_state":    to,
+		"state_reason":     reason,
+		"state_changed_at": now,
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	res := database.DB.Model(&models.User{}).Where("id = ? AND account_state = ?", user.ID, from).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errStateTransition
+	}
+	user.AccountState = to
+	user.StateReason = reason
+	user.StateChangedAt = &now
+
+	desc := "Account state changed from " + from + " to " + to
+	if reason != "" {
+		desc += ": " + reason
+	}
+	recordEvent(c, user.ID, "account_state_changed", desc, fiber.Map{"from": from, "to": to, "reason": reason})
+	return nil
+}
+
+// activateVerified moves an unverified account to active once its e-mail
+// address has been verified.
+func activateVerified(c *fiber.Ctx, user *models.User) {
+	if user.AccountState == models.AccountUnverified {
+		_ = setAccountState(c, user, models.AccountActive, "e-mail verified", nil)
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// adminAudit records an admin API call. target is 0 when the action is not
+// about a single user.
+func adminAudit(c *fiber.Ctx, action string, target uint64, details string) {
+	admin, _ := c.Locals("user").(*models.User)
+	if admin == nil {
+		return
+	}
+	now := time.Now()
+	entry := models.AdminAudit{
+		AdminID:   admin.ID,
+		Action:    action,
+		Details:   truncate(details, 255),
+		IP:        c.IP(),
+		CreatedAt: &now,
+	}
+	if target != 0 {
+		entry.TargetUserID = &target
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("[AdminAudit] failed to record %s: %v", action, err)
+	}
+}
+
+// pageParams reads ?page= and ?limit= (default 1 and 20, limit capped at 100).
+func pageParams(c *fiber.Ctx) (page, limit int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit = c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// adminTarget loads the user named by :id.
+func adminTarget(c *fiber.Ctx) (*models.User, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, utils.Fail(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+	var user models.User
+	if err := database.DB.Preload("Roles").First(&user, id).Error; err != nil {
+		return nil, utils.Fail(c, fiber.StatusNotFound, "User not found")
+	}
+	return &user, nil
+}
+
+func adminUserResponse(u *models.User) fiber.Map {
+	roles := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		roles = append(roles, r.Name)
+	}
+	return fiber.Map{
+		"id":                    u.ID,
+		"nama":                  u.Nama,
+		"email":                 u.Email,
+		"phone":                 u.Phone,
+		"email_verified":        u.EmailVerifiedAt != nil,
+		"mfa_enabled":           u.MFAEnabled(),
+		"account_state":         u.AccountState,
+		"state_reason":          u.StateReason,
+		"state_changed_at":      u.StateChangedAt,
+		"deletion_scheduled_at": u.DeletionScheduledAt,
+		"pin_locked_until":      u.PinLockedUntil,
+		"roles":                 roles,
+		"created_at":            u.CreatedAt,
+	}
+}
+
+// AdminSearchUsers - search accounts by e-mail, name or phone, optionally
+// only those in one account state
+// GET /api/v1/admin/users?q=&state=&page=&limit=
+func AdminSearchUsers(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	state := c.Query("state")
+	if state != "" && !models.ValidAccountState(state) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid state")
+	}
+	page, limit := pageParams(c)
+
+	db := database.DB.Model(&models.User{})
+	if q != "" {
+		like := "%" + q + "%"
+		db = db.Where("email LIKE ? OR nama LIKE ? OR phone LIKE ?", like, like, like)
+	}
+	if state != "" {
+		db = db.Where("account_state = ?", state)
+	}
+	var total int64
+	db.Count(&total)
+
+	var users []models.User
+	if err := db.Preload("Roles").Order("id").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to search users")
+	}
+	items := make([]fiber.Map, 0, len(users))
+	for i := range users {
+		items = append(items, adminUserResponse(&users[i]))
+	}
+	adminAudit(c, "search_users", 0, "q="+q+" state="+state)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"users": items, "total": total, "page": page, "limit": limit})
+}
+
+// AdminGetUser - account details, including active lockouts
+// GET /api/v1/admin/users/:id
+func AdminGetUser(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	var locks []models.AuthThrottle
+	database.DB.Where("user_id = ? AND locked_until > ?", user.ID, time.Now()).Find(&locks)
+
+	resp := adminUserResponse(user)
+	resp["lockouts"] = locks
+	adminAudit(c, "view_user", user.ID, "")
+	return utils.Ok(c, fiber.StatusOK, resp)
+}
+
+// AdminUserHistory - account history of a user, with the same filters as
+// the user's own history
+// GET /api/v1/admin/users/:id/history?event=&from=&to=&actor_id=&cursor=&limit=&format=
+func AdminUserHistory(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	adminAudit(c, "view_history", user.ID, string(c.Request().URI().QueryString()))
+	return listHistory(c, user.ID)
+}
+
+// AdminDisableUser - suspend an account: block login and end every session
+// POST /api/v1/admin/users/:id/disable
+func AdminDisableUser(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	var body dto.DisableUserRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	return adminChangeState(c, user, models.AccountSuspended, body.Reason)
+}
+
+// AdminEnableUser - lift a suspension or lock
+// POST /api/v1/admin/users/:id/enable
+func AdminEnableUser(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	if !user.Suspended() && !user.Locked() {
+		return utils.Fail(c, fiber.StatusConflict, "User is not suspended or locked")
+	}
+	return adminChangeState(c, user, user.UsableState(), "enabled by an administrator")
+}
+
+// AdminForcePasswordReset - lock the account: log the user out everywhere
+// and block login until they reset their password through the
+// forgot-password flow
+// POST /api/v1/admin/users/:id/force-password-reset
+func AdminForcePasswordReset(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	return adminChangeState(c, user, models.AccountLocked, "password reset required")
+}
+
+// AdminSetAccountState - move an account to any allowed state
+// PUT /api/v1/admin/users/:id/state
+func AdminSetAccountState(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	var body dto.SetAccountStateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if !models.ValidAccountState(body.State) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid state")
+	}
+	// Deletion is scheduled by the user, who confirms it with a password.
+	if body.State == models.AccountPendingDeletion {
+		return utils.Fail(c, fiber.StatusBadRequest, "Only the user can schedule account deletion")
+	}
+	return adminChangeState(c, user, body.State, body.Reason)
+}
+
+// adminChangeState applies an administrator's state change. Suspending or
+// locking needs a reason and ends every session; leaving pending_deletion
+// cancels the scheduled deletion.
+func adminChangeState(c *fiber.Ctx, user *models.User, to, reason string) error {
+	reason = strings.TrimSpace(reason)
+	blocking := to == models.AccountSuspended || to == models.AccountLocked
+	if blocking && reason == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "reason is required")
+	}
+	if admin, _ := c.Locals("user").(*models.User); admin != nil && admin.ID == user.ID && blocking {
+		return utils.Fail(c, fiber.StatusBadRequest, "You cannot disable your own account")
+	}
+	if user.AccountState == to {
+		return utils.Fail(c, fiber.StatusConflict, "User is already "+to)
+	}
+
+	from := user.AccountState
+	var extra map[string]interface{}
+	if from == models.AccountPendingDeletion {
+		extra = map[string]interface{}{"deletion_scheduled_at": nil}
+	}
+	if err := setAccountState(c, user, to, reason, extra); err != nil {
+		if errors.Is(err, errStateTransition) {
+			return utils.Fail(c, fiber.StatusConflict, err.Error())
+		}
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to update user")
+	}
+	if blocking {
+		if _, err := revokeUserSessions(user.ID, 0, "account_"+to); err != nil {
+			log.Printf("[AdminChangeState] failed to revoke sessions: %v", err)
+		}
+	}
+	adminAudit(c, "set_account_state", user.ID, from+" -> "+to+": "+reason)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Account state updated", "account_state": to})
+}
+
+// AdminUnlockUser - clear login/OTP/MFA throttles and the PIN lockout
+// POST /api/v1/admin/users/:id/unlock
+func AdminUnlockUser(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	// Login keys are created before the account is known, so match by e-mail too.
+	res := database.DB.Where("user_id = ? OR `key` IN ?", user.ID, models.EmailThrottleKeys(user.Email)).
+		Delete(&models.AuthThrottle{})
+	if res.Error != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to unlock user")
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"pin_failed_attempts": 0,
+		"pin_locked_until":    nil,
+	}).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to unlock user")
+	}
+	adminAudit(c, "unlock_user", user.ID, "")
+	recordEvent(c, user.ID, "account_unlocked", "Lockouts cleared by an administrator", nil)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "User unlocked", "throttles_cleared": res.RowsAffected})
+}
+
+// AdminSetRoles - replace the roles of a user
+// PUT /api/v1/admin/users/:id/roles
+func AdminSetRoles(c *fiber.Ctx) error {
+	user, err := adminTarget(c)
+	if user == nil {
+		return err
+	}
+	var body dto.SetRolesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	var roles []models.Role
+	if len(body.Roles) > 0 {
+		if err := database.DB.Where("name IN ?", body.Roles).Find(&roles).Error; err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to load roles")
+		}
+		if len(roles) != len(body.Roles) {
+			return utils.Fail(c, fiber.StatusBadRequest, "Unknown role")
+		}
+	}
+	if admin, _ := c.Locals("user").(*models.User); admin != nil && admin.ID == user.ID {
+		return utils.Fail(c, fiber.StatusBadRequest, "You cannot change your own roles")
+	}
+	if err := database.DB.Model(user).Association("Roles").Replace(roles); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to update roles")
+	}
+	adminAudit(c, "set_roles", user.ID, strings.Join(body.Roles, ","))
+	recordEvent(c, user.ID, "roles_changed", "Roles set to: "+strings.Join(body.Roles, ", "), nil)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"roles": body.Roles})
+}
+
+// AdminListRoles - roles and their permissions
+// GET /api/v1/admin/roles
+func AdminListRoles(c *fiber.Ctx) error {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to load roles")
+	}
+	adminAudit(c, "list_roles", 0, "")
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"roles": roles})
+}
+
+// AdminAuditLog - admin actions, newest first
+// GET /api/v1/admin/audit?admin_id=&user_id=&page=&limit=
+func AdminAuditLog(c *fiber.Ctx) error {
+	page, limit := pageParams(c)
+	db := database.DB.Model(&models.AdminAudit{})
+	if v := c.QueryInt("admin_id"); v > 0 {
+		db = db.Where("admin_id = ?", v)
+	}
+	if v := c.QueryInt("user_id"); v > 0 {
+		db = db.Where("target_user_id = ?", v)
+	}
+	var items []models.AdminAudit
+	if err := db.Order("id desc").Offset((page - 1) * limit).Limit(limit).Find(&items).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch audit log")
+	}
+	adminAudit(c, "view_audit", 0, "")
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"entries": items, "page": page, "limit": limit})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// CreateAPIKey - create a personal access token; the token is returned once
+// POST /api/v1/me/tokens
+func CreateAPIKey(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.CreateAPIKeyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 100 {
+		return utils.Fail(c, fiber.StatusBadRequest, "Nama token wajib diisi (maks. 100 karakter)")
+	}
+	if len(body.Scopes) == 0 {
+		return utils.Fail(c, fiber.StatusBadRequest, "Minimal satu scope wajib dipilih")
+	}
+	for _, s := range body.Scopes {
+		if !validScope(s) {
+			return utils.Fail(c, fiber.StatusBadRequest, "Scope tidak dikenal: "+s)
+		}
+	}
+	if body.ExpiresInDays < 0 {
+		return utils.Fail(c, fiber.StatusBadRequest, "expires_in_days tidak valid")
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat token")
+	}
+	token := models.APIKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    user.ID,
+		Name:      body.Name,
+		Prefix:    token[:12],
+		TokenHash: utils.HashToken(token),
+		Scopes:    strings.Join(body.Scopes, " "),
+	}
+	if body.ExpiresInDays > 0 {
+		exp := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		key.ExpiresAt = &exp
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat token")
+	}
+	recordEvent(c, user.ID, "api_key_created", fmt.Sprintf("API key #%d (%s) created", key.ID, key.Name), nil)
+
+	res := apiKeyResponse(&key)
+	res["token"] = token
+	return utils.Ok(c, fiber.StatusCreated, res)
+}
+
+// ListAPIKeys - list the user's API keys (without secrets)
+// GET /api/v1/me/tokens
+func ListAPIKeys(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Order("created_at desc").Find(&keys).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch tokens")
+	}
+	items := make([]fiber.Map, 0, len(keys))
+	for i := range keys {
+		items = append(items, apiKeyResponse(&keys[i]))
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"tokens": items, "available_scopes": models.AllScopes})
+}
+
+// RevokeAPIKey - revoke an API key
+// DELETE /api/v1/me/tokens/:id
+func RevokeAPIKey(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid token ID")
+	}
+	var key models.APIKey
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).First(&key).Error; err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Token not found")
+	}
+	if err := database.DB.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke token")
+	}
+	recordEvent(c, user.ID, "api_key_revoked", fmt.Sprintf("API key #%d (%s) revoked", key.ID, key.Name), nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Token revoked"})
+}
+
+func apiKeyResponse(k *models.APIKey) fiber.Map {
+	return fiber.Map{
+		"id":           k.ID,
+		"name":         k.Name,
+		"prefix":       k.Prefix,
+		"scopes":       k.ScopeList(),
+		"expires_at":   k.ExpiresAt,
+		"last_used_at": k.LastUsedAt,
+		"created_at":   k.CreatedAt,
+	}
+}
+
+func validScope(scope string) bool {
+	for _, s := range models.AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 
 	"autentikasi/config"
 	"autentikasi/database"
@@ -29,11 +28,15 @@ func Register(c *fiber.Ctx) error {
 	if body.Email == "" {
 		return utils.Fail(c, fiber.StatusBadRequest, "E-mail wajib diisi")
 	}
-	if !strings.Contains(body.Email, "@") || !strings.Contains(body.Email, ".") {
+	if !validEmail(body.Email) {
 		return utils.Fail(c, fiber.StatusBadRequest, "Format e-mail tidak valid")
 	}
-	if len(body.Password) < 6 {
-		return utils.Fail(c, fiber.StatusBadRequest, "Kata sandi minimal 6 karakter")
+	cfg := config.Load()
+	if perr := checkNewPassword(cfg, &models.User{Email: body.Email, Nama: body.Nama}, body.Password); perr != nil {
+		return passwordRejected(c, perr)
+	}
+	if body.Pin != "" && !validPin(body.Pin) {
+		return utils.Fail(c, fiber.StatusBadRequest, "PIN harus 4-6 digit angka")
 	}
 
 	var exists int64
@@ -41,13 +44,27 @@ func Register(c *fiber.Ctx) error {
 	if exists > 0 {
 		return utils.Fail(c, fiber.StatusConflict, "E-mail sudah terdaftar")
 	}
+	// A soft-deleted account still holds the unique e-mail until its grace
+	// period is over. Only an account the purge job would already remove is
+	// purged here; registering must not cut the grace period short.
+	var stale models.User
+	if err := database.DB.Unscoped().Where("email = ? AND deleted_at IS NOT NULL", body.Email).First(&stale).Error; err == nil {
+		if !stale.DueForPurge(time.Now()) {
+			return utils.Fail(c, fiber.StatusConflict, "E-mail sudah terdaftar")
+		}
+		if err := database.PurgeUser(stale.ID); err != nil {
+			log.Printf("[Register] failed to purge deleted account %d: %v", stale.ID, err)
+			return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat pengguna")
+		}
+	}
 
 	hashPass, _ := utils.Hash(body.Password)
 
 	user := models.User{
-		Nama:     body.Nama,
-		Email:    body.Email,
-		Password: hashPass,
+		Nama:         body.Nama,
+		Email:        body.Email,
+		Password:     hashPass,
+		AccountState: models.AccountUnverified,
 	}
 
 	// PIN opsional
@@ -64,12 +81,17 @@ func Register(c *fiber.Ctx) error {
 	if err := database.DB.Create(&user).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat pengguna")
 	}
+	savePasswordHistory(cfg, user.ID, user.Password)
+
+	// The account works right away; the user can verify later or ask for a resend.
+	_ = sendEmailVerification(c, &user)
 
 	return utils.Ok(c, fiber.StatusCreated, fiber.Map{
-		"id":    user.ID,
-		"nama":  user.Nama,
-		"email": user.Email,
-		"img":   user.ImgURL,
+		"id":             user.ID,
+		"nama":           user.Nama,
+		"email":          user.Email,
+		"img":            user.ImgURL,
+		"email_verified": false,
 	})
 }
 
@@ -88,44 +110,62 @@ func Login(c *fiber.Ctx) error {
 		return utils.Fail(c, fiber.StatusBadRequest, "Kata sandi wajib diisi")
 	}
 
+	clientID, ok := resolveClientID(c, body.ClientID)
+	if !ok {
+		return utils.Fail(c, fiber.StatusBadRequest, "Unknown client_id")
+	}
+
+	acctKey, ipKey := accountThrottle("login", email, 0), ipThrottle("login", c)
+	if wait, err := throttleRetryAfter(acctKey, ipKey); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
 	var user models.User
 	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		throttleFailure(acctKey, ipKey)
 		return utils.Fail(c, fiber.StatusNotFound, "E-mail kamu tidak ditemukan")
 	}
+	acctKey.UserID = user.ID
 	if ok := utils.Check(body.Password, user.Password); !ok {
+		throttleFailure(acctKey, ipKey)
+		if wait, err := throttleRetryAfter(acctKey, ipKey); err != nil {
+			return throttleUnavailable(c, err)
+		} else if wait > 0 {
+			return tooManyAttempts(c, wait)
+		}
 		return utils.Fail(c, fiber.StatusUnauthorized, "Kata sandi kamu salah")
 	}
+	throttleSuccess(acctKey)
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+	// Upgrade hashes made with an older algorithm or cost while the
+	// plaintext is at hand, so raising the cost needs no password resets.
+	if utils.NeedsRehash(user.Password) {
+		go rehashPassword(user.ID, user.Password, body.Password)
+	}
 
-	cfg := config.Load()
-	claims := jwt.MapClaims{
-		"sub":   user.ID,
-		"email": user.Email,
-		"nama":  user.Nama,
-		"exp":   time.Now().Add(24 * time.Hour).Unix(),
+	// With 2FA enabled the password only earns a short-lived mfa_pending
+	// token; tokens are issued by VerifyMFA once the second factor checks out.
+	if user.MFAEnabled() {
+		challenge, err := mfaChallenge(&user)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+		}
+		return utils.Ok(c, fiber.StatusOK, challenge)
 	}
-	token, err := utils.SignJWT(cfg.JWTSecret, claims)
+
+	tokens, err := startSession(c, &user, body.DeviceName, clientID)
 	if err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
 	}
 
 	// Record login event
-	go func(u models.User) {
-		now := time.Now()
-		ah := models.AccountHistory{
-			UserID:      u.ID,
-			Event:       "login",
-			Description: "User logged in",
-			CreatedAt:   &now,
-		}
-		if err := database.DB.Create(&ah).Error; err != nil {
-			// log but don't fail
-			log.Printf("[AccountHistory] failed to record login: %v", err)
-		}
-	}(user)
+	recordLogin(c, &user, "login", "User logged in")
 
-	return utils.Ok(c, fiber.StatusOK, fiber.Map{
-		"token": token,
-	})
+	return utils.Ok(c, fiber.StatusOK, tokens)
 }
 
 func Me(c *fiber.Ctx) error {
@@ -134,19 +174,19 @@ func Me(c *fiber.Ctx) error {
 		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
 	}
 	// calculate balance from transactions
-	var income float64
-	var expense float64
-	// sum pemasukan
+	var income models.Money
+	var expense models.Money
+	// sum pemasukan; deleted transactions do not count
 	database.DB.Raw(
-		"SELECT COALESCE(SUM(jumlah),0) FROM transactions WHERE user_id = ? AND jenis = ?",
-		user.ID, "pemasukan",
+		"SELECT COALESCE(SUM(jumlah_sen),0) FROM transactions WHERE user_id = ? AND jenis = ? AND deleted_at IS NULL",
+		user.ID, models.JenisPemasukan,
 	).Scan(&income)
 	// sum pengeluaran
 	database.DB.Raw(
-		"SELECT COALESCE(SUM(jumlah),0) FROM transactions WHERE user_id = ? AND jenis = ?",
-		user.ID, "pengeluaran",
+		"SELECT COALESCE(SUM(jumlah_sen),0) FROM transactions WHERE user_id = ? AND jenis = ? AND deleted_at IS NULL",
+		user.ID, models.JenisPengeluaran,
 	).Scan(&expense)
-	balance := int64(income - expense)
+	balance := income - expense
 
 	// optional fields
 	var birthdayStr *string
@@ -156,46 +196,84 @@ func Me(c *fiber.Ctx) error {
 	}
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{
-		"id":       user.ID,
-		"nama":     user.Nama,
-		"email":    user.Email,
-		"img":      user.ImgURL,
-		"balance":  balance,
-		"phone":    user.Phone,
-		"gender":   user.Gender,
-		"birthday": birthdayStr,
-		"status":   user.Status,
+		"id":                    user.ID,
+		"nama":                  user.Nama,
+		"email":                 user.Email,
+		"img":                   user.ImgURL,
+		"balance":               balance,
+		"phone":                 user.Phone,
+		"gender":                user.Gender,
+		"birthday":              birthdayStr,
+		"status":                user.Status,
+		"email_verified":        user.EmailVerifiedAt != nil,
+		"account_state":         user.AccountState,
+		"deletion_scheduled_at": user.DeletionScheduledAt,
 	})
 }
 
-// Logout - record logout event (token should be discarded client-side)
+// Logout - revoke the current session and record logout event
 func Logout(c *fiber.Ctx) error {
 	user, ok := c.Locals("user").(*models.User)
 	if !ok || user == nil {
 		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
 	}
-	now := time.Now()
-	ah := models.AccountHistory{
-		UserID:      user.ID,
-		Event:       "logout",
-		Description: "User logged out",
-		CreatedAt:   &now,
+	if sess, ok := c.Locals("session").(*models.Session); ok && sess != nil {
+		if err := revokeSession(sess, "logout"); err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke session")
+		}
 	}
-	if err := database.DB.Create(&ah).Error; err != nil {
-		log.Printf("[AccountHistory] failed to record logout: %v", err)
+	if claims, ok := c.Locals("claims").(*utils.Claims); ok {
+		if err := denylistToken(claims, "logout"); err != nil {
+			log.Printf("[Logout] failed to denylist token: %v", err)
+		}
 	}
+	recordEvent(c, user.ID, "logout", "User logged out", nil)
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Logged out"})
 }
 
-// GetAuthHistory - return recent account events for current user
+// GetAuthHistory - account events of the current user, newest first
+// GET /api/v1/auth/history?event=&from=&to=&actor_id=&cursor=&limit=&format=
 func GetAuthHistory(c *fiber.Ctx) error {
 	user, ok := c.Locals("user").(*models.User)
 	if !ok || user == nil {
 		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
 	}
-	var items []models.AccountHistory
-	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at desc").Find(&items).Error; err != nil {
-		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch history")
+	return listHistory(c, user.ID)
+}
+
+// rehashPassword replaces the stored hash with one made with the current
+// settings, unless the password changed in the meantime.
+func rehashPassword(userID uint64, oldHash, plain string) {
+	hash, err := utils.Hash(plain)
+	if err != nil {
+		log.Printf("[Login] failed to rehash password: %v", err)
+		return
+	}
+	res := database.DB.Model(&models.User{}).Where("id = ? AND password = ?", userID, oldHash).Update("password", hash)
+	if res.Error != nil {
+		log.Printf("[Login] failed to save rehashed password: %v", res.Error)
+		return
+	}
+	// Keep the history row matching the current password in the new format too.
+	if res.RowsAffected > 0 {
+		database.DB.Model(&models.PasswordHistory{}).Where("user_id = ? AND hash = ?", userID, oldHash).Update("hash", hash)
+	}
+}
+
+// loginBlocked returns why the account state blocks logins, or "" when the
+// user may log in. Unverified accounts and accounts pending deletion may log
+// in; the latter to cancel the deletion.
+func loginBlocked(user *models.User) string {
+	switch user.AccountState {
+	case models.AccountSuspended:
+		return "Akun kamu dinonaktifkan. Hubungi dukungan pelanggan"
+	case models.AccountLocked:
+		return "Kata sandi kamu harus direset. Gunakan fitur lupa kata sandi"
 	}
-	return utils.Ok(c, fiber.StatusOK, fiber.Map{"events": items})
+	return ""
+}
+
+// validEmail is the basic e-mail format check used across handlers.
+func validEmail(email string) bool {
+	return strings.Contains(email, "@") && strings.Contains(email, ".")
 }
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"autentikasi/connectors"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const connectorStateTTL = 10 * time.Minute
+
+// ConnectorState purposes
+const (
+	connectorLogin = "login"
+	connectorLink  = "link"
+)
+
+var errConnectorState = errors.New("Sesi login tidak valid atau kedaluwarsa")
+
+// beginConnectorFlow stores the state, nonce and PKCE verifier of a new
+// upstream login and returns the URL to send the user to.
+func beginConnectorFlow(conn connectors.Connector, purpose string, userID uint64, clientID, deviceName string) (string, string, error) {
+	state, err := utils.RandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := utils.RandomToken(48)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	authURL := conn.AuthCodeURL(state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if authURL == "" {
+		return "", "", errors.New("connector unavailable")
+	}
+
+	row := models.ConnectorState{
+		StateHash:    utils.HashToken(state),
+		Connector:    conn.ID(),
+		Purpose:      purpose,
+		UserID:       userID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ClientID:     clientID,
+		DeviceName:   truncate(strings.TrimSpace(deviceName), 100),
+		ExpiresAt:    time.Now().Add(connectorStateTTL),
+	}
+	if err := database.DB.Create(&row).Error; err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// finishConnectorFlow consumes the state of an upstream login and redeems
+// the code. For links, userID must be the user who started the flow.
+func finishConnectorFlow(conn connectors.Connector, purpose string, userID uint64, code, state string) (*connectors.Identity, *models.ConnectorState, error) {
+	var row models.ConnectorState
+	if err := database.DB.Where("state_hash = ? AND connector = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?",
+		utils.HashToken(state), conn.ID(), purpose, time.Now()).First(&row).Error; err != nil {
+		return nil, nil, errConnectorState
+	}
+	if row.UserID != userID {
+		return nil, nil, errConnectorState
+	}
+	res := database.DB.Model(&models.ConnectorState{}).
+		Where("id = ? AND consumed_at IS NULL", row.ID).
+		Update("consumed_at", time.Now())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, nil, errConnectorState
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	identity, err := conn.Exchange(ctx, code, row.CodeVerifier, row.Nonce)
+	if err != nil {
+		log.Printf("[Connector] %s exchange failed: %v", conn.ID(), err)
+		return nil, nil, errors.New("Login gagal diverifikasi oleh " + conn.Name())
+	}
+	return identity, &row, nil
+}
+
+// ListConnectors - upstream providers users can log in with
+// GET /api/v1/auth/connectors
+func ListConnectors(c *fiber.Ctx) error {
+	items := []fiber.Map{}
+	for _, conn := range connectors.List() {
+		items = append(items, fiber.Map{"id": conn.ID(), "name": conn.Name()})
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"connectors": items})
+}
+
+// ConnectorStart - begin logging in with an upstream provider. The client
+// opens authorization_url; the provider redirects back to the app, which
+// posts code and state to ConnectorCallback.
+// POST /api/v1/auth/connectors/:id/start
+func ConnectorStart(c *fiber.Ctx) error {
+	conn, ok := connectors.Get(c.Params("id"))
+	if !ok {
+		return utils.Fail(c, fiber.StatusNotFound, "Unknown connector")
+	}
+	var body dto.ConnectorStartRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+		}
+	}
+	clientID, ok := resolveClientID(c, body.ClientID)
+	if !ok {
+		return utils.Fail(c, fiber.StatusBadRequest, "Unknown client_id")
+	}
+	deviceName := body.DeviceName
+	if strings.TrimSpace(deviceName) == "" {
+		deviceName = c.Get("X-Device-Name")
+	}
+
+	authURL, state, err := beginConnectorFlow(conn, connectorLogin, 0, clientID, deviceName)
+	if err != nil {
+		log.Printf("[Connector] %s start failed: %v", conn.ID(), err)
+		return utils.Fail(c, fiber.StatusServiceUnavailable, conn.Name()+" sedang tidak tersedia")
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"authorization_url": authURL, "state": state})
+}
+
+// ConnectorCallback - finish an upstream login. Known identities log in
+// their user; otherwise a verified e-mail links an existing verified account
+// or a new account is created.
+// POST /api/v1/auth/connectors/:id/callback
+func ConnectorCallback(c *fiber.Ctx) error {
+	conn, ok := connectors.Get(c.Params("id"))
+	if !ok {
+		return utils.Fail(c, fiber.StatusNotFound, "Unknown connector")
+	}
+	var body dto.ConnectorCallbackRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	identity, state, err := finishConnectorFlow(conn, connectorLogin, 0, body.Code, body.State)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	var user models.User
+	var link models.ExternalIdentity
+	err = database.DB.Where("connector = ? AND subject = ?", conn.ID(), identity.Subject).First(&link).Error
+	switch {
+	case err == nil:
+		if err := database.DB.First(&user, link.UserID).Error; err != nil {
+			return utils.Fail(c, fiber.StatusUnauthorized, "User not found")
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if identity.Email == "" {
+			return utils.Fail(c, fiber.StatusBadRequest, conn.Name()+" tidak membagikan alamat e-mail")
+		}
+		err := database.DB.Where("email = ?", identity.Email).First(&user).Error
+		if err == nil {
+			if !connectors.CanLinkByEmail(identity, user.EmailVerifiedAt != nil) {
+				return utils.Fail(c, fiber.StatusConflict, "E-mail sudah terdaftar. Masuk dengan kata sandi lalu hubungkan akun dari pengaturan")
+			}
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			if user, err = registerFromIdentity(c, identity); err != nil {
+				return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat pengguna")
+			}
+		} else {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to look up user")
+		}
+		link = models.ExternalIdentity{UserID: user.ID, Connector: conn.ID(), Subject: identity.Subject, Email: identity.Email}
+		if err := database.DB.Create(&link).Error; err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to link account")
+		}
+		recordEvent(c, user.ID, "identity_linked", conn.Name()+" account linked ("+identity.Email+")", nil)
+	default:
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to look up identity")
+	}
+
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+	database.DB.Model(&link).Update("last_login_at", time.Now())
+
+	// The upstream login replaces the password, not the second factor.
+	if user.MFAEnabled() {
+		challenge, err := mfaChallenge(&user)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+		}
+		return utils.Ok(c, fiber.StatusOK, challenge)
+	}
+
+	tokens, err := startSession(c, &user, state.DeviceName, state.ClientID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	recordLogin(c, &user, "login", "User logged in with "+conn.Name())
+	return utils.Ok(c, fiber.StatusOK, tokens)
+}
+
+// registerFromIdentity creates an account for a first-time upstream login.
+// It has no password until the user sets one through forgot-password.
+func registerFromIdentity(c *fiber.Ctx, identity *connectors.Identity) (models.User, error) {
+	nama := strings.TrimSpace(identity.Name)
+	if nama == "" {
+		nama, _, _ = strings.Cut(identity.Email, "@")
+	}
+	user := models.User{Nama: truncate(nama, 100), Email: identity.Email, AccountState: models.AccountUnverified}
+	if identity.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user.AccountState = models.AccountActive
+	}
+	if identity.Picture != "" {
+		img := truncate(identity.Picture, 255)
+		user.ImgURL = &img
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		return user, err
+	}
+	if !identity.EmailVerified {
+		_ = sendEmailVerification(c, &user)
+	}
+	recordEvent(c, user.ID, "register", "Account created", nil)
+	return user, nil
+}
+
+// LinkIdentityStart - begin linking an upstream account to the current user
+// POST /api/v1/me/identities/:connector/start
+func LinkIdentityStart(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	conn, ok := connectors.Get(c.Params("connector"))
+	if !ok {
+		return utils.Fail(c, fiber.StatusNotFound, "Unknown connector")
+	}
+	authURL, state, err := beginConnectorFlow(conn, connectorLink, user.ID, "", "")
+	if err != nil {
+		log.Printf("[Connector] %s link start failed: %v", conn.ID(), err)
+		return utils.Fail(c, fiber.StatusServiceUnavailable, conn.Name()+" sedang tidak tersedia")
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"authorization_url": authURL, "state": state})
+}
+
+// LinkIdentityCallback - finish linking; the e-mail does not have to match
+// POST /api/v1/me/identities/:connector/callback
+func LinkIdentityCallback(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	conn, ok := connectors.Get(c.Params("connector"))
+	if !ok {
+		return utils.Fail(c, fiber.StatusNotFound, "Unknown connector")
+	}
+	var body dto.ConnectorCallbackRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	identity, _, err := finishConnectorFlow(conn, connectorLink, user.ID, body.Code, body.State)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	var existing models.ExternalIdentity
+	if err := database.DB.Where("connector = ? AND subject = ?", conn.ID(), identity.Subject).First(&existing).Error; err == nil {
+		if existing.UserID == user.ID {
+			return utils.Ok(c, fiber.StatusOK, existing)
+		}
+		return utils.Fail(c, fiber.StatusConflict, "Akun "+conn.Name()+" ini sudah terhubung ke pengguna lain")
+	}
+	link := models.ExternalIdentity{UserID: user.ID, Connector: conn.ID(), Subject: identity.Subject, Email: identity.Email}
+	if err := database.DB.Create(&link).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to link account")
+	}
+	recordEvent(c, user.ID, "identity_linked", conn.Name()+" account linked ("+identity.Email+")", nil)
+	return utils.Ok(c, fiber.StatusCreated, link)
+}
+
+// ListIdentities - upstream accounts linked to the current user
+// GET /api/v1/me/identities
+func ListIdentities(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var links []models.ExternalIdentity
+	if err := database.DB.Where("user_id = ?", user.ID).Order("id").Find(&links).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch identities")
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"identities": links, "has_password": user.Password != ""})
+}
+
+// UnlinkIdentity - remove a linked upstream account. The last login method
+// of an account without a password cannot be removed.
+// DELETE /api/v1/me/identities/:id
+func UnlinkIdentity(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid identity ID")
+	}
+	var link models.ExternalIdentity
+	if err := database.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&link).Error; err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Identity not found")
+	}
+	var count int64
+	database.DB.Model(&models.ExternalIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	if !connectors.CanUnlink(user.Password != "", count) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Atur kata sandi lewat lupa kata sandi sebelum melepas satu-satunya metode masuk")
+	}
+	if err := database.DB.Delete(&link).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to unlink identity")
+	}
+	recordEvent(c, user.ID, "identity_unlinked", link.Connector+" account unlinked ("+link.Email+")", nil)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Identity unlinked"})
+}
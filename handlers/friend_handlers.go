@@ -87,9 +87,9 @@ func SearchUserByPhone(c *fiber.Ctx) error {
 			}
 
 			// Try phone_digits column first
-			if err := database.DB.Where("phone_digits IN ?", variants).Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
+			if err := database.DB.Scopes(models.Discoverable).Where("phone_digits IN ?", variants).Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
 				found = true
-			} else if err := database.DB.Where("REPLACE(REPLACE(REPLACE(phone, '+', ''), ' ', ''), '-', '') IN ?", variants).Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
+			} else if err := database.DB.Scopes(models.Discoverable).Where("REPLACE(REPLACE(REPLACE(phone, '+', ''), ' ', ''), '-', '') IN ?", variants).Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
 				found = true
 			}
 		}
@@ -97,7 +97,7 @@ func SearchUserByPhone(c *fiber.Ctx) error {
 
 	// Try search by name if provided and phone search failed/not provided
 	if !found && name != "" {
-		if err := database.DB.Where("LOWER(nama) LIKE ?", "%"+strings.ToLower(name)+"%").Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
+		if err := database.DB.Scopes(models.Discoverable).Where("LOWER(nama) LIKE ?", "%"+strings.ToLower(name)+"%").Find(&foundUsers).Error; err == nil && len(foundUsers) > 0 {
 			found = true
 		}
 	}
@@ -165,9 +165,9 @@ func SendFriendRequest(c *fiber.Ctx) error {
 	}
 
 	var friend models.User
-	if err := database.DB.Where("phone_digits = ?", digits).First(&friend).Error; err != nil {
+	if err := database.DB.Scopes(models.Discoverable).Where("phone_digits = ?", digits).First(&friend).Error; err != nil {
 		// fallback to exact phone comparison
-		if err := database.DB.Where("phone = ?", req.Phone).First(&friend).Error; err != nil {
+		if err := database.DB.Scopes(models.Discoverable).Where("phone = ?", req.Phone).First(&friend).Error; err != nil {
 			fmt.Printf("[FRIEND_REQUEST_ERROR] User not found by phone: %s (digits: %s)\n", req.Phone, digits)
 			return utils.Fail(c, fiber.StatusNotFound, "User not found")
 		}
@@ -208,6 +208,7 @@ func SendFriendRequest(c *fiber.Ctx) error {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to send friend request")
 	}
 	fmt.Printf("[FRIEND_REQUEST] Success: UserID=%d -> FriendID=%d\n", user.ID, friend.ID)
+	recordEvent(c, user.ID, "friend_request_sent", "Friend request sent to "+friend.Nama, fiber.Map{"friendship_id": friendship.ID, "friend_id": friend.ID})
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend request sent"})
 }
@@ -235,6 +236,7 @@ func AcceptFriendRequest(c *fiber.Ctx) error {
 	if err := database.DB.Save(&friendship).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to accept friend request")
 	}
+	recordFriendEvent(c, user.ID, &friendship, "friend_request_accepted", "Friend request accepted")
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend request accepted"})
 }
@@ -261,6 +263,7 @@ func RejectFriendRequest(c *fiber.Ctx) error {
 	if err := database.DB.Delete(&friendship).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to reject friend request")
 	}
+	recordFriendEvent(c, user.ID, &friendship, "friend_request_rejected", "Friend request rejected")
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend request rejected"})
 }
@@ -293,8 +296,8 @@ func AcceptFriendRequestByPhone(c *fiber.Ctx) error {
 
 	// Find friend by phone
 	var friend models.User
-	if err := database.DB.Where("phone_digits = ?", digits).First(&friend).Error; err != nil {
-		if err := database.DB.Where("phone = ?", phone).First(&friend).Error; err != nil {
+	if err := database.DB.Scopes(models.Discoverable).Where("phone_digits = ?", digits).First(&friend).Error; err != nil {
+		if err := database.DB.Scopes(models.Discoverable).Where("phone = ?", phone).First(&friend).Error; err != nil {
 			return utils.Fail(c, fiber.StatusNotFound, "User not found")
 		}
 	}
@@ -314,6 +317,7 @@ func AcceptFriendRequestByPhone(c *fiber.Ctx) error {
 	}
 
 	fmt.Printf("[ACCEPT] Success: UserID=%d accepted request from UserID=%d\n", user.ID, friend.ID)
+	recordFriendEvent(c, user.ID, &friendship, "friend_request_accepted", "Friend request from "+friend.Nama+" accepted")
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend request accepted"})
 }
 
@@ -365,6 +369,7 @@ func RejectFriendRequestByPhone(c *fiber.Ctx) error {
 	}
 
 	fmt.Printf("[REJECT] Success: UserID=%d rejected request from UserID=%d\n", user.ID, friend.ID)
+	recordFriendEvent(c, user.ID, &friendship, "friend_request_rejected", "Friend request from "+friend.Nama+" rejected")
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend request rejected"})
 }
 
@@ -508,6 +513,7 @@ func DeleteFriend(c *fiber.Ctx) error {
 	if err := database.DB.Delete(&friendship).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to delete friendship")
 	}
+	recordFriendEvent(c, user.ID, &friendship, "friend_removed", "Friend removed")
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Friend removed"})
 }
@@ -543,9 +549,20 @@ func ToggleDebt(c *fiber.Ctx) error {
 	if err := database.DB.Save(&friendship).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to update debt status")
 	}
+	recordFriendEvent(c, user.ID, &friendship, "friend_debt_toggled", "Debt status with a friend changed")
 
 	return utils.Ok(c, fiber.StatusOK, fiber.Map{
 		"message":      "Debt status toggled",
 		"debt_user_id": friendship.DebtUserID,
 	})
 }
+
+// recordFriendEvent records a friend action in the history of the user who
+// took it, with the friendship and the other user as metadata.
+func recordFriendEvent(c *fiber.Ctx, userID uint64, f *models.Friendship, event, description string) {
+	other := f.FriendID
+	if other == userID {
+		other = f.UserID
+	}
+	recordEvent(c, userID, event, description, fiber.Map{"friendship_id": f.ID, "friend_id": other})
+}
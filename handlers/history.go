@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"autentikasi/database"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const (
+	historyDefaultLimit = 50
+	historyMaxLimit     = 200
+	// CSV exports stop after this many rows; narrow the dates for more.
+	historyExportLimit = 10000
+)
+
+// recordHistory writes an AccountHistory row for an event the service
+// records on its own, outside of a request made by the user.
+func recordHistory(userID uint64, event, description string) {
+	recordEvent(nil, userID, event, description, nil)
+}
+
+// recordEvent writes an AccountHistory row in the background, with the IP,
+// user agent and actor of the request c (when not nil) and meta as its
+// metadata. Failures are logged but never fail the request that triggered
+// them.
+func recordEvent(c *fiber.Ctx, userID uint64, event, description string, meta fiber.Map) {
+	ah := models.AccountHistory{
+		UserID:      userID,
+		Event:       event,
+		Description: strings.Clone(truncate(description, 255)),
+	}
+	if c != nil {
+		// Request strings point into buffers Fiber reuses; copy them before
+		// they reach the goroutine below.
+		ah.IP = c.IP()
+		ah.UserAgent = strings.Clone(truncate(c.Get(fiber.HeaderUserAgent), 255))
+		// Logged-in requests are made by whoever owns the token, which may
+		// be an administrator; the rest by the user the event is about.
+		actor := userID
+		if u, ok := c.Locals("user").(*models.User); ok && u != nil {
+			actor = u.ID
+		}
+		ah.ActorID = &actor
+		if key, ok := c.Locals("api_key").(*models.APIKey); ok && key != nil {
+			withKey := fiber.Map{"api_key_id": key.ID}
+			for k, v := range meta {
+				withKey[k] = v
+			}
+			meta = withKey
+		}
+	}
+	if len(meta) > 0 {
+		if b, err := json.Marshal(meta); err == nil {
+			ah.Metadata = b
+		}
+	}
+	go func() {
+		now := time.Now()
+		ah.CreatedAt = &now
+		if err := database.DB.Create(&ah).Error; err != nil {
+			log.Printf("[AccountHistory] failed to record %s: %v", event, err)
+		}
+	}()
+}
+
+// historyQuery applies the filters of a history request: event (comma
+// separated event types), from and to (see timeRange) and actor_id.
+func historyQuery(c *fiber.Ctx, userID uint64) (*gorm.DB, error) {
+	db := database.DB.Model(&models.AccountHistory{}).Where("user_id = ?", userID)
+	if v := strings.TrimSpace(c.Query("event")); v != "" {
+		var events []string
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				events = append(events, e)
+			}
+		}
+		if len(events) > 0 {
+			db = db.Where("event IN ?", events)
+		}
+	}
+	db, err := timeRange(c, db, "created_at")
+	if err != nil {
+		return nil, err
+	}
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid actor_id")
+		}
+		db = db.Where("actor_id = ?", id)
+	}
+	return db, nil
+}
+
+// timeRange applies the from and to query parameters (RFC 3339 or
+// YYYY-MM-DD; a date-only to includes that whole day) to column.
+func timeRange(c *fiber.Ctx, db *gorm.DB, column string) (*gorm.DB, error) {
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseTimeParam(v)
+		if err != nil {
+			return nil, errors.New("Invalid from date")
+		}
+		db = db.Where(column+" >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseTimeParam(v)
+		if err != nil {
+			return nil, errors.New("Invalid to date")
+		}
+		if dateOnly {
+			db = db.Where(column+" < ?", to.AddDate(0, 0, 1))
+		} else {
+			db = db.Where(column+" <= ?", to)
+		}
+	}
+	return db, nil
+}
+
+func parseTimeParam(v string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err = time.ParseInLocation(time.DateOnly, v, time.Local)
+	return t, true, err
+}
+
+// listHistory answers a history request for userID: a page of events,
+// newest first, or with format=csv every matching event as a CSV file.
+// Pages are cursor based: pass next_cursor of the previous page as cursor.
+func listHistory(c *fiber.Ctx, userID uint64) error {
+	db, err := historyQuery(c, userID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+	}
+	if c.Query("format") == "csv" {
+		var items []models.AccountHistory
+		if err := db.Order("id desc").Limit(historyExportLimit).Find(&items).Error; err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch history")
+		}
+		return sendHistoryCSV(c, userID, items)
+	}
+
+	limit := c.QueryInt("limit", historyDefaultLimit)
+	if limit < 1 || limit > historyMaxLimit {
+		limit = historyDefaultLimit
+	}
+	if v := c.Query("cursor"); v != "" {
+		before, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid cursor")
+		}
+		db = db.Where("id < ?", before)
+	}
+	var items []models.AccountHistory
+	if err := db.Order("id desc").Limit(limit + 1).Find(&items).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch history")
+	}
+	var next *string
+	if len(items) > limit {
+		items = items[:limit]
+		cursor := strconv.FormatUint(items[limit-1].ID, 10)
+		next = &cursor
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"events": items, "next_cursor": next, "limit": limit})
+}
+
+func sendHistoryCSV(c *fiber.Ctx, userID uint64, items []models.AccountHistory) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "created_at", "event", "description", "ip", "user_agent", "actor_id", "metadata"})
+	for _, h := range items {
+		created, actor := "", ""
+		if h.CreatedAt != nil {
+			created = h.CreatedAt.Format(time.RFC3339)
+		}
+		if h.ActorID != nil {
+			actor = strconv.FormatUint(*h.ActorID, 10)
+		}
+		_ = w.Write([]string{
+			strconv.FormatUint(h.ID, 10), created, h.Event, csvSafe(h.Description),
+			h.IP, csvSafe(h.UserAgent), actor, string(h.Metadata),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to export history")
+	}
+	name := "history-" + strconv.FormatUint(userID, 10) + "-" + time.Now().Format("20060102") + ".csv"
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	return c.Status(fiber.StatusOK).Send(buf.Bytes())
+}
+
+// csvSafe keeps spreadsheet apps from running user-controlled text (a
+// device name, a friend's name) as a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const (
+	deviceCookie    = "dompetku_device"
+	deviceCookieTTL = 2 * 365 * 24 * time.Hour
+
+	// How many earlier logins are compared to tell whether a network is new.
+	loginNetworkLookback = 50
+)
+
+// loginEvents are the history events written by recordLogin.
+var loginEvents = []string{"login", "login_passkey", "login_magic_link"}
+
+// deviceID returns the id the client's device identifies itself with: the
+// X-Device-ID header (apps) or the device cookie (browsers). Devices without
+// one get a new id, sent back in both.
+func deviceID(c *fiber.Ctx) string {
+	id := strings.TrimSpace(c.Get("X-Device-ID"))
+	if id == "" {
+		id = c.Cookies(deviceCookie)
+	}
+	if id == "" || len(id) > 128 {
+		var err error
+		if id, err = utils.RandomToken(16); err != nil {
+			return ""
+		}
+	}
+	c.Set("X-Device-ID", id)
+	c.Cookie(&fiber.Cookie{
+		Name:     deviceCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  time.Now().Add(deviceCookieTTL),
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return id
+}
+
+// loginInfo is what recordLogin keeps about a login, copied out of the
+// request (Fiber reuses its buffers) so it can be used after the handler
+// returns.
+type loginInfo struct {
+	userID      uint64
+	email       string
+	event       string
+	description string
+	ip          string
+	userAgent   string
+	deviceHash  string
+	deviceLabel string
+	baseURL     string
+}
+
+// recordLogin writes the history entry of a successful login with the IP,
+// user agent and device it came from, and e-mails the user when the device
+// or the network has not been seen on the account before.
+func recordLogin(c *fiber.Ctx, user *models.User, event, description string) {
+	info := loginInfo{
+		userID:      user.ID,
+		email:       user.Email,
+		event:       event,
+		description: description,
+		ip:          c.IP(),
+		userAgent:   strings.Clone(truncate(c.Get(fiber.HeaderUserAgent), 255)),
+		baseURL:     publicBaseURL(),
+	}
+	if id := deviceID(c); id != "" {
+		info.deviceHash = utils.HashToken(id)
+	}
+	info.deviceLabel = strings.Clone(strings.TrimSpace(c.Get("X-Device-Name")))
+	if info.deviceLabel == "" {
+		info.deviceLabel = info.userAgent
+	}
+	if info.deviceLabel == "" {
+		info.deviceLabel = "Perangkat tidak dikenal"
+	}
+	go checkLogin(config.Load(), info)
+}
+
+func checkLogin(cfg *config.Config, info loginInfo) {
+	// Look at earlier logins before this one is written.
+	var earlierIPs []string
+	database.DB.Model(&models.AccountHistory{}).
+		Where("user_id = ? AND event IN ? AND ip <> ''", info.userID, loginEvents).
+		Order("id desc").Limit(loginNetworkLookback).Pluck("ip", &earlierIPs)
+	var devices int64
+	database.DB.Model(&models.KnownDevice{}).Where("user_id = ?", info.userID).Count(&devices)
+
+	now := time.Now()
+	actor := info.userID
+	ah := models.AccountHistory{
+		UserID:      info.userID,
+		ActorID:     &actor,
+		Event:       info.event,
+		Description: truncate(info.description, 255),
+		IP:          info.ip,
+		UserAgent:   info.userAgent,
+		DeviceHash:  info.deviceHash,
+		CreatedAt:   &now,
+	}
+	if err := database.DB.Create(&ah).Error; err != nil {
+		log.Printf("[AccountHistory] failed to record %s: %v", info.event, err)
+	}
+
+	newDevice := false
+	if info.deviceHash != "" {
+		var known models.KnownDevice
+		err := database.DB.Where("user_id = ? AND device_hash = ?", info.userID, info.deviceHash).First(&known).Error
+		if err == nil {
+			database.DB.Model(&known).Updates(map[string]interface{}{
+				"ip":           info.ip,
+				"user_agent":   info.userAgent,
+				"last_seen_at": now,
+			})
+		} else {
+			database.DB.Create(&models.KnownDevice{
+				UserID:      info.userID,
+				DeviceHash:  info.deviceHash,
+				UserAgent:   info.userAgent,
+				IP:          info.ip,
+				FirstSeenAt: now,
+				LastSeenAt:  &now,
+			})
+			// The first device of an account (or the first since device
+			// tracking started) is not news to anyone.
+			newDevice = devices > 0
+		}
+	}
+	newNetwork := len(earlierIPs) > 0 && !seenNetwork(info.ip, earlierIPs)
+
+	if !cfg.LoginAlerts || (!newDevice && !newNetwork) {
+		return
+	}
+	reason := "perangkat baru"
+	switch {
+	case newDevice && newNetwork:
+		reason = "perangkat baru dan jaringan yang belum pernah dipakai"
+	case newNetwork:
+		reason = "jaringan yang belum pernah dipakai"
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		log.Printf("[LoginAlert] failed to create token: %v", err)
+		return
+	}
+	vc := models.VerificationCode{
+		UserID:    info.userID,
+		Purpose:   models.PurposeLoginAlert,
+		Email:     info.email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(cfg.LoginAlertTTL),
+	}
+	if err := database.DB.Create(&vc).Error; err != nil {
+		log.Printf("[LoginAlert] failed to store token: %v", err)
+		return
+	}
+	link := info.baseURL + "/api/v1/auth/not-me?token=" + url.QueryEscape(token)
+	if cfg.LoginAlertURL != "" {
+		sep := "?"
+		if strings.Contains(cfg.LoginAlertURL, "?") {
+			sep = "&"
+		}
+		link = cfg.LoginAlertURL + sep + "token=" + url.QueryEscape(token)
+	}
+	if err := utils.SendLoginAlertEmail(cfg, info.email, reason, info.deviceLabel, info.ip, now, link); err != nil {
+		log.Printf("[LoginAlert] failed to send email: %v", err)
+		return
+	}
+	recordHistory(info.userID, "login_alert", "Login alert sent: "+reason)
+}
+
+// seenNetwork reports whether ip is in the same network as one of the
+// earlier addresses: the same /24 for IPv4, the same /48 for IPv6.
+func seenNetwork(ip string, earlier []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return true // nothing to compare; do not alert on garbage
+	}
+	bits, size := 48, 128
+	if v4 := addr.To4(); v4 != nil {
+		addr, bits, size = v4, 24, 32
+	}
+	network := &net.IPNet{IP: addr.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}
+	for _, e := range earlier {
+		if prev := net.ParseIP(e); prev != nil && network.Contains(prev) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfirmReportLogin - where the "this wasn't me" link lands when no app
+// page is configured. It only checks the token and hands it back: mail
+// scanners open links on their own, so nothing changes until the token is
+// POSTed to ReportLogin.
+// GET /api/v1/auth/not-me?token=
+func ConfirmReportLogin(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "Token wajib diisi")
+	}
+	var vc models.VerificationCode
+	if err := database.DB.Where("purpose = ? AND consumed_at IS NULL AND token_hash = ?",
+		models.PurposeLoginAlert, utils.HashToken(token)).First(&vc).Error; err != nil || time.Now().After(vc.ExpiresAt) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Tautan tidak valid atau sudah kedaluwarsa")
+	}
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"message": "Kirim token ini lewat POST /api/v1/auth/not-me untuk mengeluarkan semua perangkat dan mengunci akun",
+		"token":   token,
+	})
+}
+
+// ReportLogin - the "this wasn't me" link of a login alert: log out every
+// device, revoke API keys and lock the account until the password is reset
+// POST /api/v1/auth/not-me
+func ReportLogin(c *fiber.Ctx) error {
+	var body dto.ReportLoginRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if body.Token == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "Token wajib diisi")
+	}
+
+	vc, err := consumeVerificationCode(models.PurposeLoginAlert, 0, "", "", body.Token)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Tautan tidak valid atau sudah kedaluwarsa")
+	}
+	var user models.User
+	if err := database.DB.First(&user, vc.UserID).Error; err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "User not found")
+	}
+
+	if _, err := revokeUserSessions(user.ID, 0, "login_reported"); err != nil {
+		log.Printf("[ReportLogin] failed to revoke sessions: %v", err)
+	}
+	database.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", time.Now())
+	// The other links of the same incident have nothing left to do.
+	database.DB.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", user.ID, models.PurposeLoginAlert).
+		Delete(&models.VerificationCode{})
+
+	// A suspended account stays suspended; anything else is locked.
+	if !user.Suspended() && !user.Locked() {
+		var extra map[string]interface{}
+		if user.PendingDeletion() {
+			extra = map[string]interface{}{"deletion_scheduled_at": nil}
+		}
+		if err := setAccountState(c, &user, models.AccountLocked, "login reported by the user", extra); err != nil {
+			log.Printf("[ReportLogin] failed to lock account: %v", err)
+			return utils.Fail(c, fiber.StatusInternalServerError, "Gagal mengunci akun")
+		}
+	}
+	recordEvent(c, user.ID, "login_reported", "A login was reported as not made by the user", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"message": "Semua perangkat telah dikeluarkan. Reset kata sandi kamu lewat fitur lupa kata sandi",
+	})
+}
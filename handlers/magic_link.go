@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const magicLinkCooldown = time.Minute
+
+// RequestMagicLink - e-mail a one-time login code (and link). The answer is
+// the same whether or not the address has an account.
+// POST /api/v1/auth/magic-link
+func RequestMagicLink(c *fiber.Ctx) error {
+	var body dto.MagicLinkRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	email := strings.TrimSpace(strings.ToLower(body.Email))
+	if !validEmail(email) {
+		return utils.Fail(c, fiber.StatusBadRequest, "Format e-mail tidak valid")
+	}
+
+	// Every request counts against the IP so the endpoint cannot be used to
+	// flood inboxes from one address.
+	ipKey := ipThrottle("magic_request", c)
+	if wait, err := throttleRetryAfter(ipKey); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	throttleFailure(ipKey)
+
+	sent := func() error {
+		return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Jika e-mail terdaftar, kode masuk telah dikirim"})
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil || !user.CanAuthenticate() {
+		return sent()
+	}
+	if last := lastVerificationSent(user.ID, models.PurposeMagicLogin); last != nil && time.Since(*last) < magicLinkCooldown {
+		return sent()
+	}
+
+	cfg := config.Load()
+	code, token, err := issueVerificationCode(user.ID, models.PurposeMagicLogin, user.Email, cfg.MagicLinkTTL)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal membuat kode masuk")
+	}
+	link := ""
+	if cfg.MagicLinkURL != "" {
+		sep := "?"
+		if strings.Contains(cfg.MagicLinkURL, "?") {
+			sep = "&"
+		}
+		link = cfg.MagicLinkURL + sep + "token=" + url.QueryEscape(token)
+	}
+	go func(cfg *config.Config, email, code, link string) {
+		if err := utils.SendMagicLinkEmail(cfg, email, code, link); err != nil {
+			log.Printf("[MagicLink] failed to send email: %v", err)
+		}
+	}(cfg, user.Email, code, link)
+	return sent()
+}
+
+// VerifyMagicLink - exchange the e-mailed token, or e-mail + code, for a
+// session. Codes and links work once; 2FA still applies.
+// POST /api/v1/auth/magic-link/verify
+func VerifyMagicLink(c *fiber.Ctx) error {
+	var body dto.MagicLinkVerifyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	email := strings.TrimSpace(strings.ToLower(body.Email))
+	if body.Token == "" && (email == "" || body.Code == "") {
+		return utils.Fail(c, fiber.StatusBadRequest, "E-mail dan kode wajib diisi")
+	}
+	clientID, ok := resolveClientID(c, body.ClientID)
+	if !ok {
+		return utils.Fail(c, fiber.StatusBadRequest, "Unknown client_id")
+	}
+
+	// Codes are only six digits, so guesses are throttled per IP and per
+	// address on top of the per-code attempt limit.
+	keys := []throttleKey{ipThrottle("magic", c)}
+	if body.Token == "" {
+		keys = append(keys, accountThrottle("magic", email, 0))
+	}
+	if wait, err := throttleRetryAfter(keys...); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	vc, err := consumeVerificationCode(models.PurposeMagicLogin, 0, email, body.Code, body.Token)
+	if err != nil {
+		throttleFailure(keys...)
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+	throttleSuccess(keys[1:]...)
+
+	var user models.User
+	if err := database.DB.First(&user, vc.UserID).Error; err != nil || user.Email != vc.Email {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Kode verifikasi salah")
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+	// Receiving the code proves control of the address.
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		database.DB.Model(&user).Update("email_verified_at", now)
+		user.EmailVerifiedAt = &now
+		recordEvent(c, user.ID, "email_verified", "E-mail address verified", nil)
+	}
+	activateVerified(c, &user)
+
+	if user.MFAEnabled() {
+		challenge, err := mfaChallenge(&user)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+		}
+		return utils.Ok(c, fiber.StatusOK, challenge)
+	}
+
+	tokens, err := startSession(c, &user, body.DeviceName, clientID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	recordLogin(c, &user, "login_magic_link", "User logged in with an e-mailed code")
+	return utils.Ok(c, fiber.StatusOK, tokens)
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const recoveryCodeCount = 10
+
+// SetupTOTP - Step 1 of enrollment: generate a secret and otpauth:// URI
+// POST /api/v1/auth/mfa/totp/setup
+func SetupTOTP(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if user.TOTPEnabled() {
+		return utils.Fail(c, fiber.StatusConflict, "Autentikasi dua faktor sudah aktif")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to generate secret")
+	}
+	if err := database.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to save secret")
+	}
+
+	cfg := config.Load()
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"secret":      secret,
+		"otpauth_url": utils.TOTPURI(cfg.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP - Step 2 of enrollment: prove the authenticator works, then
+// enable 2FA and hand out recovery codes (shown only once)
+// POST /api/v1/auth/mfa/totp/confirm
+func ConfirmTOTP(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if user.TOTPEnabled() {
+		return utils.Fail(c, fiber.StatusConflict, "Autentikasi dua faktor sudah aktif")
+	}
+	if user.TOTPSecret == nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Mulai pendaftaran 2FA terlebih dahulu")
+	}
+
+	var body dto.TOTPCodeRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	step, ok := utils.ValidateTOTP(*user.TOTPSecret, strings.TrimSpace(body.Code), time.Now())
+	if !ok {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Kode 2FA salah")
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_enabled_at": now,
+		"totp_last_step":  step,
+	}).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to enable 2FA")
+	}
+
+	// Users who already protect the account with a passkey keep their codes.
+	resp := fiber.Map{}
+	if !user.HasPasskeys {
+		codes, err := replaceRecoveryCodes(user.ID)
+		if err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to generate recovery codes")
+		}
+		resp["recovery_codes"] = codes
+	}
+	recordEvent(c, user.ID, "mfa_enabled", "Two-factor authentication enabled", nil)
+
+	return utils.Ok(c, fiber.StatusOK, resp)
+}
+
+// DisableTOTP - remove the authenticator app; requires the password and a
+// current second factor. 2FA stays on while the user has passkeys.
+// POST /api/v1/auth/mfa/totp/disable
+func DisableTOTP(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if !user.TOTPEnabled() {
+		return utils.Fail(c, fiber.StatusBadRequest, "Autentikasi dua faktor belum aktif")
+	}
+
+	var body dto.DisableTOTPRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if ok, err := verifyPassword(c, user, body.Password, "Kata sandi kamu salah"); !ok {
+		return err
+	}
+	if _, err := verifySecondFactor(user, body.Code, body.RecoveryCode, body.Credential); err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":     nil,
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to disable 2FA")
+	}
+	if user.HasPasskeys {
+		recordEvent(c, user.ID, "totp_disabled", "Authenticator app removed", nil)
+		return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Authenticator app removed"})
+	}
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+	recordEvent(c, user.ID, "mfa_disabled", "Two-factor authentication disabled", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "2FA disabled"})
+}
+
+// RegenerateRecoveryCodes - invalidate old recovery codes and issue new ones
+// POST /api/v1/auth/mfa/recovery-codes
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	if !user.MFAEnabled() {
+		return utils.Fail(c, fiber.StatusBadRequest, "Autentikasi dua faktor belum aktif")
+	}
+
+	var body dto.RecoveryCodesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if _, err := verifySecondFactor(user, body.Code, "", body.Credential); err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	codes, err := replaceRecoveryCodes(user.ID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to generate recovery codes")
+	}
+	recordEvent(c, user.ID, "recovery_codes_regenerated", "Recovery codes regenerated", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"recovery_codes": codes})
+}
+
+// VerifyMFA - Step 2 of login: exchange the mfa_pending token plus a TOTP
+// code, passkey assertion or recovery code for a real session
+// POST /api/v1/auth/mfa/verify
+func VerifyMFA(c *fiber.Ctx) error {
+	var body dto.MFAVerifyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if body.MFAToken == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "mfa_token wajib diisi")
+	}
+
+	claims, err := utils.ParseJWT(body.MFAToken)
+	if err != nil || claims.Type != utils.TokenMFAPending {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Sesi verifikasi tidak valid atau kedaluwarsa")
+	}
+	clientID, ok := resolveClientID(c, body.ClientID)
+	if !ok {
+		return utils.Fail(c, fiber.StatusBadRequest, "Unknown client_id")
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID()).Error; err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "User not found")
+	}
+	if !user.MFAEnabled() {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Sesi verifikasi tidak valid atau kedaluwarsa")
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+
+	acctKey, ipKey := accountThrottle("mfa", strconv.FormatUint(user.ID, 10), user.ID), ipThrottle("mfa", c)
+	if wait, err := throttleRetryAfter(acctKey, ipKey); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	method, err := verifySecondFactor(&user, body.Code, body.RecoveryCode, body.Credential)
+	if err != nil {
+		throttleFailure(acctKey, ipKey)
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+	throttleSuccess(acctKey)
+
+	tokens, err := startSession(c, &user, body.DeviceName, clientID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	recordLogin(c, &user, "login", "User logged in with "+method)
+
+	return utils.Ok(c, fiber.StatusOK, tokens)
+}
+
+// mfaChallenge is returned by Login instead of tokens when 2FA is enabled.
+// methods tells the client which second factors the user can offer.
+func mfaChallenge(user *models.User) (fiber.Map, error) {
+	cfg := config.Load()
+	claims, err := utils.NewClaims(utils.TokenMFAPending, user.ID, nil, cfg.MFATokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	token, err := utils.SignJWT(claims)
+	if err != nil {
+		return nil, err
+	}
+	methods := []string{}
+	if user.TOTPEnabled() {
+		methods = append(methods, "totp")
+	}
+	if user.HasPasskeys {
+		methods = append(methods, "passkey")
+	}
+	methods = append(methods, "recovery_code")
+	return fiber.Map{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"methods":      methods,
+		"expires_in":   int64(cfg.MFATokenTTL.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor accepts a TOTP code, a passkey assertion or an unused
+// recovery code and returns which one was used. TOTP codes cannot be
+// replayed: the matched time step must be newer than the last accepted one.
+func verifySecondFactor(user *models.User, code, recoveryCode string, credential *dto.WebAuthnCredential) (string, error) {
+	code = strings.TrimSpace(code)
+	switch {
+	case credential != nil && user.HasPasskeys:
+		if _, err := verifyPasskeyAssertion(credential, models.WebAuthnMFA, user.ID, false); err != nil {
+			return "", err
+		}
+		return "passkey", nil
+
+	case code != "" && user.TOTPSecret != nil:
+		step, ok := utils.ValidateTOTP(*user.TOTPSecret, code, time.Now())
+		if !ok {
+			return "", errors.New("Kode 2FA salah")
+		}
+		res := database.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return "", errors.New("Kode 2FA sudah digunakan")
+		}
+		user.TOTPLastStep = step
+		return "totp", nil
+
+	case recoveryCode != "":
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+		res := database.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).
+			Update("used_at", time.Now())
+		if res.Error != nil || res.RowsAffected == 0 {
+			return "", errors.New("Kode pemulihan salah atau sudah digunakan")
+		}
+		recordHistory(user.ID, "recovery_code_used", "Recovery code used for two-factor authentication")
+		return "recovery_code", nil
+	}
+	return "", errors.New("Kode 2FA wajib diisi")
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a fresh
+// set, returning the plaintext codes to show the user once.
+func replaceRecoveryCodes(userID uint64) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code)),
+		})
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// validRedirectURI accepts absolute URIs without a fragment. Custom schemes
+// (com.example.app:/callback) are allowed for mobile apps.
+func validRedirectURI(raw string) bool {
+	if raw == "" || strings.ContainsAny(raw, " \t\n") {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return u.Host != ""
+	}
+	return true
+}
+
+// AdminCreateOAuthClient - register an application for "Sign in with
+// Dompetku". The secret is only returned here.
+// POST /api/v1/admin/oauth-clients
+func AdminCreateOAuthClient(c *fiber.Ctx) error {
+	admin, ok := c.Locals("user").(*models.User)
+	if !ok || admin == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var body dto.CreateOAuthClientRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "name is required")
+	}
+	if len(body.RedirectURIs) == 0 {
+		return utils.Fail(c, fiber.StatusBadRequest, "redirect_uris is required")
+	}
+	for _, u := range body.RedirectURIs {
+		if !validRedirectURI(u) {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid redirect URI: "+u)
+		}
+	}
+
+	clientID, err := utils.RandomToken(16)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create client")
+	}
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         truncate(body.Name, 100),
+		RedirectURIs: strings.Join(body.RedirectURIs, " "),
+		CreatedBy:    admin.ID,
+	}
+	var secret string
+	if !body.Public {
+		if secret, err = utils.RandomToken(32); err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create client")
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+	if err := database.DB.Create(&client).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create client")
+	}
+	adminAudit(c, "create_oauth_client", 0, client.ClientID+" "+client.Name)
+
+	resp := oauthClientResponse(&client)
+	if secret != "" {
+		resp["client_secret"] = secret
+	}
+	return utils.Ok(c, fiber.StatusCreated, resp)
+}
+
+func oauthClientResponse(client *models.OAuthClient) fiber.Map {
+	return fiber.Map{
+		"client_id":     client.ClientID,
+		"name":          client.Name,
+		"public":        client.Public(),
+		"redirect_uris": client.RedirectURIList(),
+		"created_by":    client.CreatedBy,
+		"created_at":    client.CreatedAt,
+		"revoked_at":    client.RevokedAt,
+	}
+}
+
+// AdminListOAuthClients - registered applications
+// GET /api/v1/admin/oauth-clients
+func AdminListOAuthClients(c *fiber.Ctx) error {
+	var clients []models.OAuthClient
+	if err := database.DB.Order("id desc").Find(&clients).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch clients")
+	}
+	items := make([]fiber.Map, 0, len(clients))
+	for i := range clients {
+		items = append(items, oauthClientResponse(&clients[i]))
+	}
+	adminAudit(c, "list_oauth_clients", 0, "")
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"clients": items})
+}
+
+// AdminRevokeOAuthClient - disable an application and end its sessions
+// DELETE /api/v1/admin/oauth-clients/:client_id
+func AdminRevokeOAuthClient(c *fiber.Ctx) error {
+	client, err := activeClient(c.Params("client_id"))
+	if err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Client not found")
+	}
+	now := time.Now()
+	if err := database.DB.Model(client).Update("revoked_at", now).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke client")
+	}
+	if err := database.DB.Model(&models.Session{}).
+		Where("client_id = ? AND scope <> '' AND revoked_at IS NULL", client.ClientID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": "client_revoked"}).Error; err != nil {
+		log.Printf("[AdminRevokeOAuthClient] failed to revoke sessions: %v", err)
+	}
+	adminAudit(c, "revoke_oauth_client", 0, client.ClientID+" "+client.Name)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Client revoked"})
+}
+
+// ListOAuthConsents - applications the current user signed in to
+// GET /api/v1/me/oauth/consents
+func ListOAuthConsents(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var consents []models.OAuthConsent
+	if err := database.DB.Where("user_id = ?", user.ID).Order("updated_at desc").Find(&consents).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch consents")
+	}
+	items := make([]fiber.Map, 0, len(consents))
+	for _, consent := range consents {
+		var client models.OAuthClient
+		database.DB.Where("client_id = ?", consent.ClientID).First(&client)
+		items = append(items, fiber.Map{
+			"client_id":  consent.ClientID,
+			"name":       client.Name,
+			"scopes":     strings.Fields(consent.Scope),
+			"granted_at": consent.CreatedAt,
+			"updated_at": consent.UpdatedAt,
+		})
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"consents": items})
+}
+
+// RevokeOAuthConsent - forget a consent and sign the user out of the app
+// DELETE /api/v1/me/oauth/consents/:client_id
+func RevokeOAuthConsent(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	clientID := c.Params("client_id")
+	res := database.DB.Where("user_id = ? AND client_id = ?", user.ID, clientID).Delete(&models.OAuthConsent{})
+	if res.Error != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke consent")
+	}
+	if res.RowsAffected == 0 {
+		return utils.Fail(c, fiber.StatusNotFound, "Consent not found")
+	}
+	database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND client_id = ? AND scope <> '' AND revoked_at IS NULL", user.ID, clientID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": "consent_revoked"})
+	recordEvent(c, user.ID, "oauth_consent_revoked", "Access revoked for client "+clientID, nil)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Consent revoked"})
+}
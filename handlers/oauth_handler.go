@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+const (
+	oauthRequestTTL = 10 * time.Minute // time the user has to approve the consent screen
+	oauthCodeTTL    = time.Minute      // lifetime of an authorization code
+)
+
+// oauthError writes an RFC 6749 error response. The OAuth endpoints use the
+// standard format instead of utils.Fail so off-the-shelf clients understand it.
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(fiber.Map{"error": code, "error_description": description})
+}
+
+// withQuery appends params to a registered redirect URI.
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parseScope drops duplicate scopes and reports false when one is unknown.
+func parseScope(raw string) (string, bool) {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(raw) {
+		known := false
+		for _, k := range models.OIDCScopes {
+			if s == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", false
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, " "), true
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// activeClient loads a client that has not been revoked.
+func activeClient(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if clientID == "" {
+		return nil, errors.New("missing client_id")
+	}
+	if err := database.DB.Where("client_id = ? AND revoked_at IS NULL", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// OIDCDiscovery - OpenID Provider metadata
+// GET /.well-known/openid-configuration
+func OIDCDiscovery(c *fiber.Ctx) error {
+	base := publicBaseURL()
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{
+		"issuer":                                config.Load().JWTIssuer,
+		"authorization_endpoint":                base + "/oauth/authorize",
+		"token_endpoint":                        base + "/oauth/token",
+		"userinfo_endpoint":                     base + "/oauth/userinfo",
+		"jwks_uri":                              base + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{utils.SigningAlg()},
+		"scopes_supported":                      models.OIDCScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "name", "picture", "email", "email_verified", "phone_number"},
+	})
+}
+
+// OAuthAuthorize - start of the authorization code flow. Errors that happen
+// before the redirect URI is trusted are returned as JSON; later ones are
+// sent back to the client.
+// GET /oauth/authorize
+func OAuthAuthorize(c *fiber.Ctx) error {
+	client, err := activeClient(c.Query("client_id"))
+	if err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_client", "Unknown client_id")
+	}
+	redirectURI := c.Query("redirect_uri")
+	if uris := client.RedirectURIList(); redirectURI == "" && len(uris) == 1 {
+		redirectURI = uris[0]
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	state := c.Query("state")
+	fail := func(code, description string) error {
+		return c.Redirect(withQuery(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {state},
+		}), fiber.StatusFound)
+	}
+	if c.Query("response_type") != "code" {
+		return fail("unsupported_response_type", "Only response_type=code is supported")
+	}
+	scope, ok := parseScope(c.Query("scope"))
+	if !ok || !hasScope(scope, models.OIDCScopeOpenID) {
+		return fail("invalid_scope", "scope must include openid and only supported scopes")
+	}
+	challenge := c.Query("code_challenge")
+	if challenge == "" || c.Query("code_challenge_method") != "S256" {
+		return fail("invalid_request", "PKCE with code_challenge_method=S256 is required")
+	}
+
+	requestID, err := utils.RandomToken(24)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to start authorization")
+	}
+	auth := models.OAuthAuthorization{
+		RequestID:     requestID,
+		ClientID:      client.ClientID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		State:         truncate(state, 255),
+		Nonce:         truncate(c.Query("nonce"), 255),
+		CodeChallenge: truncate(challenge, 128),
+		ExpiresAt:     time.Now().Add(oauthRequestTTL),
+	}
+	if err := database.DB.Create(&auth).Error; err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to start authorization")
+	}
+
+	if consentURL := config.Load().OIDCConsentURL; consentURL != "" {
+		return c.Redirect(withQuery(consentURL, url.Values{"request_id": {requestID}}), fiber.StatusFound)
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"request_id":  requestID,
+		"consent_api": "/api/v1/oauth/authorize/" + requestID,
+	})
+}
+
+// pendingAuthorization loads an authorization request the user has not
+// answered yet.
+func pendingAuthorization(requestID string) (*models.OAuthAuthorization, *models.OAuthClient, error) {
+	var auth models.OAuthAuthorization
+	if err := database.DB.Where("request_id = ? AND user_id = 0 AND consumed_at IS NULL AND expires_at > ?", requestID, time.Now()).
+		First(&auth).Error; err != nil {
+		return nil, nil, err
+	}
+	client, err := activeClient(auth.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &auth, client, nil
+}
+
+// OAuthConsentInfo - what the consent screen has to show
+// GET /api/v1/oauth/authorize/:request_id
+func OAuthConsentInfo(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	auth, client, err := pendingAuthorization(c.Params("request_id"))
+	if err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Permintaan otorisasi tidak ditemukan atau kedaluwarsa")
+	}
+	var consent models.OAuthConsent
+	approved := database.DB.Where("user_id = ? AND client_id = ?", user.ID, client.ClientID).First(&consent).Error == nil &&
+		consent.Covers(auth.Scope)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"request_id":       auth.RequestID,
+		"client":           fiber.Map{"client_id": client.ClientID, "name": client.Name},
+		"scopes":           strings.Fields(auth.Scope),
+		"already_approved": approved,
+		"expires_at":       auth.ExpiresAt,
+	})
+}
+
+// OAuthConsent - approve or deny an authorization request. The web app
+// sends the browser to redirect_to afterwards.
+// POST /api/v1/oauth/authorize/:request_id
+func OAuthConsent(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var body dto.OAuthConsentRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	auth, client, err := pendingAuthorization(c.Params("request_id"))
+	if err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Permintaan otorisasi tidak ditemukan atau kedaluwarsa")
+	}
+	now := time.Now()
+
+	if !body.Approve {
+		database.DB.Model(auth).Update("consumed_at", now)
+		return utils.Ok(c, fiber.StatusOK, fiber.Map{"redirect_to": withQuery(auth.RedirectURI, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"The user denied the request"},
+			"state":             {auth.State},
+		})})
+	}
+
+	code, err := utils.RandomToken(32)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to issue code")
+	}
+	codeHash := utils.HashToken(code)
+	// Conditional update so a request can only be approved once.
+	res := database.DB.Model(&models.OAuthAuthorization{}).
+		Where("id = ? AND user_id = 0", auth.ID).
+		Updates(map[string]interface{}{"user_id": user.ID, "code_hash": codeHash, "expires_at": now.Add(oauthCodeTTL)})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return utils.Fail(c, fiber.StatusConflict, "Permintaan otorisasi sudah dijawab")
+	}
+
+	consent := models.OAuthConsent{UserID: user.ID, ClientID: client.ClientID}
+	database.DB.Where(models.OAuthConsent{UserID: user.ID, ClientID: client.ClientID}).FirstOrCreate(&consent)
+	if !consent.Covers(auth.Scope) {
+		merged, _ := parseScope(consent.Scope + " " + auth.Scope)
+		database.DB.Model(&consent).Update("scope", merged)
+		recordEvent(c, user.ID, "oauth_consent", "Allowed "+client.Name+" to access: "+auth.Scope, nil)
+	}
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"redirect_to": withQuery(auth.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {auth.State},
+	})})
+}
+
+// clientCredentials reads client_id/client_secret from HTTP Basic auth or,
+// failing that, from the form body.
+func clientCredentials(c *fiber.Ctx, body *dto.OAuthTokenRequest) (string, string) {
+	if h := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(h, "Basic ") {
+		if raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(h, "Basic ")); err == nil {
+			if id, secret, ok := strings.Cut(string(raw), ":"); ok {
+				id, _ = url.QueryUnescape(id)
+				secret, _ = url.QueryUnescape(secret)
+				return id, secret
+			}
+		}
+	}
+	return body.ClientID, body.ClientSecret
+}
+
+// authenticateClient checks the client secret. Public clients have none and
+// are bound to the code by PKCE instead.
+func authenticateClient(clientID, secret string) (*models.OAuthClient, bool) {
+	client, err := activeClient(clientID)
+	if err != nil {
+		return nil, false
+	}
+	if client.Public() {
+		return client, secret == ""
+	}
+	ok := subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) == 1
+	return client, ok
+}
+
+// OAuthToken - exchange an authorization code or refresh token
+// POST /oauth/token
+func OAuthToken(c *fiber.Ctx) error {
+	var body dto.OAuthTokenRequest
+	if err := c.BodyParser(&body); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Invalid body")
+	}
+	client, ok := authenticateClient(clientCredentials(c, &body))
+	if !ok {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+	cfg := config.Load()
+
+	switch body.GrantType {
+	case "authorization_code":
+		var auth models.OAuthAuthorization
+		if err := database.DB.Where("code_hash = ? AND client_id = ?", utils.HashToken(body.Code), client.ClientID).
+			First(&auth).Error; err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		}
+		if auth.ConsumedAt != nil {
+			// A code used twice may have been intercepted: revoke what it issued.
+			var sess models.Session
+			if auth.SessionID != 0 && database.DB.First(&sess, auth.SessionID).Error == nil {
+				_ = revokeSession(&sess, "authorization_code_reuse")
+			}
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Authorization code already used")
+		}
+		if time.Now().After(auth.ExpiresAt) || auth.RedirectURI != body.RedirectURI {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		}
+		if !utils.VerifyPKCE(body.CodeVerifier, auth.CodeChallenge) {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid code_verifier")
+		}
+		res := database.DB.Model(&models.OAuthAuthorization{}).
+			Where("id = ? AND consumed_at IS NULL", auth.ID).
+			Update("consumed_at", time.Now())
+		if res.Error != nil || res.RowsAffected == 0 {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Authorization code already used")
+		}
+
+		var user models.User
+		if err := database.DB.First(&user, auth.UserID).Error; err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "User not found")
+		}
+		if msg := loginBlocked(&user); msg != "" {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", msg)
+		}
+
+		now := time.Now()
+		sess := models.Session{
+			UserID:     user.ID,
+			ClientID:   client.ClientID,
+			Scope:      auth.Scope,
+			DeviceName: truncate(client.Name, 100),
+			UserAgent:  truncate(c.Get(fiber.HeaderUserAgent), 255),
+			IP:         c.IP(),
+			LastSeenAt: &now,
+			ExpiresAt:  now.Add(cfg.RefreshTokenTTL),
+		}
+		if err := database.DB.Create(&sess).Error; err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to create session")
+		}
+		database.DB.Model(&auth).Update("session_id", sess.ID)
+
+		tokens, err := issueOAuthTokens(cfg, client, &user, &sess, auth.Nonce)
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to sign token")
+		}
+		recordEvent(c, user.ID, "oauth_login", "Signed in to "+client.Name, nil)
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(tokens)
+
+	case "refresh_token":
+		sess, err := rotateRefreshToken(body.RefreshToken, func(s *models.Session) bool {
+			return s.Scope != "" && s.ClientID == client.ClientID
+		})
+		if err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		}
+		var user models.User
+		if err := database.DB.First(&user, sess.UserID).Error; err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "User not found")
+		}
+		if msg := loginBlocked(&user); msg != "" {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", msg)
+		}
+		database.DB.Model(sess).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": c.IP()})
+
+		tokens, err := issueOAuthTokens(cfg, client, &user, sess, "")
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to sign token")
+		}
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(tokens)
+	}
+	return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "Use authorization_code or refresh_token")
+}
+
+// issueOAuthTokens signs an access token and ID token for an OAuth client
+// session. A refresh token is only issued for the offline_access scope.
+func issueOAuthTokens(cfg *config.Config, client *models.OAuthClient, user *models.User, sess *models.Session, nonce string) (fiber.Map, error) {
+	aud := []string{client.ClientID}
+
+	access, err := utils.NewClaims(utils.TokenOAuthAccess, user.ID, aud, cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	access.SessionID = sess.ID
+	access.Scope = sess.Scope
+	access.ClientID = client.ClientID
+	accessToken, err := utils.SignJWT(access)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := utils.NewClaims("", user.ID, aud, cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	id := utils.IDTokenClaims{Nonce: nonce, RegisteredClaims: base.RegisteredClaims}
+	if sess.CreatedAt != nil {
+		id.AuthTime = sess.CreatedAt.Unix()
+	}
+	if hasScope(sess.Scope, models.OIDCScopeProfile) {
+		id.Name = user.Nama
+	}
+	if hasScope(sess.Scope, models.OIDCScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		id.Email = user.Email
+		id.EmailVerified = &verified
+	}
+	idToken, err := utils.SignJWT(id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(cfg.AccessTokenTTL.Seconds()),
+		"scope":        sess.Scope,
+		"id_token":     idToken,
+	}
+	if hasScope(sess.Scope, models.OIDCScopeOfflineAccess) {
+		refresh, err := newRefreshToken(sess)
+		if err != nil {
+			return nil, err
+		}
+		resp["refresh_token"] = refresh
+	}
+	return resp, nil
+}
+
+// OAuthUserInfo - claims about the user, limited to the granted scopes
+// GET|POST /oauth/userinfo
+func OAuthUserInfo(c *fiber.Ctx) error {
+	invalid := func() error {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_token", "Invalid access token")
+	}
+	auth := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return invalid()
+	}
+	claims, err := utils.ParseClientToken(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil || claims.Type != utils.TokenOAuthAccess {
+		return invalid()
+	}
+	if _, err := activeClient(claims.ClientID); err != nil {
+		return invalid()
+	}
+	var revoked int64
+	database.DB.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked)
+	if revoked > 0 {
+		return invalid()
+	}
+	var sess models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", claims.SessionID, claims.UserID()).First(&sess).Error; err != nil ||
+		!sess.Active(time.Now()) {
+		return invalid()
+	}
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID()).Error; err != nil || !user.CanAuthenticate() {
+		return invalid()
+	}
+
+	info := fiber.Map{"sub": claims.Subject}
+	if hasScope(claims.Scope, models.OIDCScopeProfile) {
+		info["name"] = user.Nama
+		if user.ImgURL != nil {
+			info["picture"] = *user.ImgURL
+		}
+	}
+	if hasScope(claims.Scope, models.OIDCScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = user.EmailVerifiedAt != nil
+	}
+	if hasScope(claims.Scope, models.OIDCScopePhone) && user.Phone != nil {
+		info["phone_number"] = *user.Phone
+	}
+	return c.JSON(info)
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+	"autentikasi/webauthn"
+)
+
+const webauthnChallengeTTL = 5 * time.Minute
+
+var errPasskey = errors.New("Passkey tidak valid")
+
+// webauthnUserHandle is the user.id given to authenticators: the 8-byte
+// big-endian user ID, so it never contains the e-mail address.
+func webauthnUserHandle(userID uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, userID)
+}
+
+// decodeB64URL accepts base64url with or without padding, as browsers differ.
+func decodeB64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// newWebAuthnChallenge stores a fresh challenge for a ceremony and returns it
+// base64url encoded for the options sent to the browser.
+func newWebAuthnChallenge(purpose string, userID uint64) (string, error) {
+	challenge, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	row := models.WebAuthnChallenge{
+		ChallengeHash: utils.HashToken(challenge),
+		Purpose:       purpose,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webauthnChallengeTTL),
+	}
+	if err := database.DB.Create(&row).Error; err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge finds the unexpired challenge echoed in
+// clientDataJSON and marks it used, so every challenge is tried only once.
+func consumeWebAuthnChallenge(clientDataJSON []byte, purpose string) (*models.WebAuthnChallenge, []byte, error) {
+	challenge, err := webauthn.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		return nil, nil, errPasskey
+	}
+	var row models.WebAuthnChallenge
+	if err := database.DB.Where("challenge_hash = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?",
+		utils.HashToken(base64.RawURLEncoding.EncodeToString(challenge)), purpose, time.Now()).First(&row).Error; err != nil {
+		return nil, nil, errors.New("Tantangan passkey tidak valid atau kedaluwarsa")
+	}
+	res := database.DB.Model(&models.WebAuthnChallenge{}).
+		Where("id = ? AND consumed_at IS NULL", row.ID).
+		Update("consumed_at", time.Now())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, nil, errors.New("Tantangan passkey tidak valid atau kedaluwarsa")
+	}
+	return &row, challenge, nil
+}
+
+// passkeyDescriptors lists the user's passkeys as allowCredentials or
+// excludeCredentials entries.
+func passkeyDescriptors(userID uint64) []fiber.Map {
+	var creds []models.WebAuthnCredential
+	database.DB.Where("user_id = ?", userID).Order("id").Find(&creds)
+	out := make([]fiber.Map, 0, len(creds))
+	for _, cred := range creds {
+		d := fiber.Map{"type": "public-key", "id": cred.CredentialID}
+		if cred.Transports != "" {
+			d["transports"] = strings.Split(cred.Transports, ",")
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// assertionOptions are the PublicKeyCredentialRequestOptions for a login or
+// second-factor ceremony.
+func assertionOptions(cfg *config.Config, challenge, userVerification string, allow []fiber.Map) fiber.Map {
+	return fiber.Map{"publicKey": fiber.Map{
+		"challenge":        challenge,
+		"rpId":             cfg.WebAuthnRPID,
+		"timeout":          webauthnChallengeTTL.Milliseconds(),
+		"userVerification": userVerification,
+		"allowCredentials": allow,
+	}}
+}
+
+// verifyPasskeyAssertion checks a navigator.credentials.get() response for a
+// challenge of the given purpose and returns the passkey that signed it.
+// userID restricts the passkey to one user; 0 accepts any user's passkey.
+func verifyPasskeyAssertion(body *dto.WebAuthnCredential, purpose string, userID uint64, requireUV bool) (*models.WebAuthnCredential, error) {
+	clientData, err := decodeB64URL(body.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errPasskey
+	}
+	ch, challenge, err := consumeWebAuthnChallenge(clientData, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 && ch.UserID != userID {
+		return nil, errPasskey
+	}
+
+	rawID := body.RawID
+	if rawID == "" {
+		rawID = body.ID
+	}
+	rawIDBytes, err := decodeB64URL(rawID)
+	if err != nil {
+		return nil, errPasskey
+	}
+	var cred models.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(rawIDBytes)).First(&cred).Error; err != nil {
+		return nil, errPasskey
+	}
+	if ch.UserID != 0 && cred.UserID != ch.UserID {
+		return nil, errPasskey
+	}
+	if body.Response.UserHandle != "" {
+		handle, err := decodeB64URL(body.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, webauthnUserHandle(cred.UserID)) {
+			return nil, errPasskey
+		}
+	}
+
+	authData, err1 := decodeB64URL(body.Response.AuthenticatorData)
+	sig, err2 := decodeB64URL(body.Response.Signature)
+	if err1 != nil || err2 != nil {
+		return nil, errPasskey
+	}
+	rp := webauthn.FromConfig(config.Load())
+	res, err := rp.VerifyAssertion(challenge, clientData, authData, sig, cred.PublicKey, cred.SignCount, requireUV)
+	if errors.Is(err, webauthn.ErrCloned) {
+		log.Printf("[Passkey] sign counter went backwards for credential %d of user %d", cred.ID, cred.UserID)
+		recordHistory(cred.UserID, "passkey_clone_suspected", "Passkey \""+cred.Name+"\" rejected: it may have been copied")
+		return nil, errPasskey
+	}
+	if errors.Is(err, webauthn.ErrUserVerify) {
+		return nil, errors.New("Passkey harus dibuka dengan PIN atau biometrik")
+	}
+	if err != nil {
+		return nil, errPasskey
+	}
+
+	now := time.Now()
+	database.DB.Model(&cred).Updates(map[string]interface{}{"sign_count": res.SignCount, "last_used_at": now})
+	cred.SignCount, cred.LastUsedAt = res.SignCount, &now
+	return &cred, nil
+}
+
+// BeginPasskeyRegistration - creation options for a new passkey
+// POST /api/v1/me/passkeys/register/begin
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	challenge, err := newWebAuthnChallenge(models.WebAuthnRegister, user.ID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create challenge")
+	}
+
+	cfg := config.Load()
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"publicKey": fiber.Map{
+		"challenge": challenge,
+		"rp":        fiber.Map{"id": cfg.WebAuthnRPID, "name": cfg.WebAuthnRPName},
+		"user": fiber.Map{
+			"id":          base64.RawURLEncoding.EncodeToString(webauthnUserHandle(user.ID)),
+			"name":        user.Email,
+			"displayName": user.Nama,
+		},
+		"pubKeyCredParams": []fiber.Map{
+			{"type": "public-key", "alg": webauthn.AlgES256},
+			{"type": "public-key", "alg": webauthn.AlgEdDSA},
+			{"type": "public-key", "alg": webauthn.AlgRS256},
+		},
+		"timeout":            webauthnChallengeTTL.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": passkeyDescriptors(user.ID),
+		"authenticatorSelection": fiber.Map{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+	}})
+}
+
+// FinishPasskeyRegistration - verify the authenticator's response and save
+// the passkey. The first second factor of an account also gets recovery
+// codes (shown only once).
+// POST /api/v1/me/passkeys/register/finish
+func FinishPasskeyRegistration(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var body dto.PasskeyRegisterFinishRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	clientData, err1 := decodeB64URL(body.Credential.Response.ClientDataJSON)
+	attestation, err2 := decodeB64URL(body.Credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Data passkey tidak valid")
+	}
+
+	ch, challenge, err := consumeWebAuthnChallenge(clientData, models.WebAuthnRegister)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+	}
+	if ch.UserID != user.ID {
+		return utils.Fail(c, fiber.StatusBadRequest, errPasskey.Error())
+	}
+	rp := webauthn.FromConfig(config.Load())
+	newCred, err := rp.VerifyRegistration(challenge, clientData, attestation, false)
+	if err != nil {
+		log.Printf("[Passkey] registration rejected for user %d: %v", user.ID, err)
+		return utils.Fail(c, fiber.StatusBadRequest, errPasskey.Error())
+	}
+
+	credID := base64.RawURLEncoding.EncodeToString(newCred.ID)
+	var count int64
+	database.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credID).Count(&count)
+	if count > 0 {
+		return utils.Fail(c, fiber.StatusConflict, "Passkey ini sudah terdaftar")
+	}
+
+	name := truncate(strings.TrimSpace(body.Name), 100)
+	if name == "" {
+		name = "Passkey"
+	}
+	cred := models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: credID,
+		PublicKey:    newCred.PublicKey,
+		SignCount:    newCred.SignCount,
+		AAGUID:       formatAAGUID(newCred.AAGUID),
+		Transports:   truncate(strings.Join(body.Credential.Response.Transports, ","), 100),
+	}
+	if err := database.DB.Create(&cred).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to save passkey")
+	}
+
+	resp := fiber.Map{"passkey": cred}
+	if !user.HasPasskeys {
+		hadMFA := user.MFAEnabled()
+		if err := database.DB.Model(user).Update("has_passkeys", true).Error; err != nil {
+			return utils.Fail(c, fiber.StatusInternalServerError, "Failed to save passkey")
+		}
+		user.HasPasskeys = true
+		if !hadMFA {
+			codes, err := replaceRecoveryCodes(user.ID)
+			if err != nil {
+				return utils.Fail(c, fiber.StatusInternalServerError, "Failed to generate recovery codes")
+			}
+			resp["recovery_codes"] = codes
+		}
+	}
+	recordEvent(c, user.ID, "passkey_added", "Passkey \""+cred.Name+"\" added", nil)
+
+	return utils.Ok(c, fiber.StatusCreated, resp)
+}
+
+// ListPasskeys - the current user's passkeys
+// GET /api/v1/me/passkeys
+func ListPasskeys(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var creds []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", user.ID).Order("id").Find(&creds).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch passkeys")
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"passkeys": creds})
+}
+
+// RenamePasskey - change a passkey's label
+// PATCH /api/v1/me/passkeys/:id
+func RenamePasskey(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	cred, err := ownPasskey(c, user)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, err.Error())
+	}
+	var body dto.RenamePasskeyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	name := truncate(strings.TrimSpace(body.Name), 100)
+	if name == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "Nama passkey wajib diisi")
+	}
+	if err := database.DB.Model(cred).Update("name", name).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to rename passkey")
+	}
+	cred.Name = name
+	return utils.Ok(c, fiber.StatusOK, cred)
+}
+
+// DeletePasskey - remove a passkey. Removing the last second factor also
+// removes the recovery codes.
+// DELETE /api/v1/me/passkeys/:id
+func DeletePasskey(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	cred, err := ownPasskey(c, user)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, err.Error())
+	}
+	if err := database.DB.Delete(cred).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to delete passkey")
+	}
+
+	var left int64
+	database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&left)
+	if left == 0 {
+		database.DB.Model(user).Update("has_passkeys", false)
+		user.HasPasskeys = false
+		if !user.TOTPEnabled() {
+			database.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+		}
+	}
+	recordEvent(c, user.ID, "passkey_removed", "Passkey \""+cred.Name+"\" removed", nil)
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Passkey deleted"})
+}
+
+func ownPasskey(c *fiber.Ctx, user *models.User) (*models.WebAuthnCredential, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, errors.New("Passkey not found")
+	}
+	var cred models.WebAuthnCredential
+	if err := database.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&cred).Error; err != nil {
+		return nil, errors.New("Passkey not found")
+	}
+	return &cred, nil
+}
+
+// BeginPasskeyLogin - request options for a passwordless login. With an
+// e-mail the user's passkeys are listed; without one the browser offers any
+// discoverable passkey for this site. The answer looks the same whether or
+// not the e-mail has passkeys.
+// POST /api/v1/auth/passkeys/login/begin
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	var body dto.PasskeyLoginBeginRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+		}
+	}
+
+	var userID uint64
+	allow := []fiber.Map{}
+	if email := strings.TrimSpace(strings.ToLower(body.Email)); email != "" {
+		var user models.User
+		if err := database.DB.Where("email = ?", email).First(&user).Error; err == nil && user.HasPasskeys {
+			userID = user.ID
+			allow = passkeyDescriptors(user.ID)
+		}
+	}
+	challenge, err := newWebAuthnChallenge(models.WebAuthnLogin, userID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create challenge")
+	}
+	return utils.Ok(c, fiber.StatusOK, assertionOptions(config.Load(), challenge, "required", allow))
+}
+
+// FinishPasskeyLogin - verify the assertion and start a session. The
+// passkey must be unlocked with a PIN or biometric, so it satisfies 2FA by
+// itself.
+// POST /api/v1/auth/passkeys/login/finish
+func FinishPasskeyLogin(c *fiber.Ctx) error {
+	var body dto.PasskeyLoginFinishRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	clientID, ok := resolveClientID(c, body.ClientID)
+	if !ok {
+		return utils.Fail(c, fiber.StatusBadRequest, "Unknown client_id")
+	}
+
+	ipKey := ipThrottle("passkey", c)
+	if wait, err := throttleRetryAfter(ipKey); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	cred, err := verifyPasskeyAssertion(&body.Credential, models.WebAuthnLogin, 0, true)
+	if err != nil {
+		throttleFailure(ipKey)
+		return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, cred.UserID).Error; err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, errPasskey.Error())
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+
+	tokens, err := startSession(c, &user, body.DeviceName, clientID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	recordLogin(c, &user, "login_passkey", "User logged in with passkey \""+cred.Name+"\"")
+	return utils.Ok(c, fiber.StatusOK, tokens)
+}
+
+// BeginPasskeyMFA - request options for using a passkey as the second factor
+// after a password (or other first-factor) login
+// POST /api/v1/auth/mfa/passkey/begin
+func BeginPasskeyMFA(c *fiber.Ctx) error {
+	var body dto.PasskeyMFABeginRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	claims, err := utils.ParseJWT(body.MFAToken)
+	if err != nil || claims.Type != utils.TokenMFAPending {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Sesi verifikasi tidak valid atau kedaluwarsa")
+	}
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID()).Error; err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "User not found")
+	}
+	return beginPasskeyCheck(c, &user)
+}
+
+// BeginPasskeyReauth - request options for confirming a sensitive change
+// (such as new recovery codes) with a passkey instead of a TOTP code
+// POST /api/v1/me/passkeys/challenge
+func BeginPasskeyReauth(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	return beginPasskeyCheck(c, user)
+}
+
+func beginPasskeyCheck(c *fiber.Ctx, user *models.User) error {
+	if !user.HasPasskeys {
+		return utils.Fail(c, fiber.StatusBadRequest, "Belum ada passkey yang terdaftar")
+	}
+	challenge, err := newWebAuthnChallenge(models.WebAuthnMFA, user.ID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create challenge")
+	}
+	return utils.Ok(c, fiber.StatusOK, assertionOptions(config.Load(), challenge, "discouraged", passkeyDescriptors(user.ID)))
+}
+
+// formatAAGUID renders the authenticator model ID in UUID form.
+func formatAAGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// requestLang is "en" when the client prefers English (Accept-Language),
+// otherwise "id".
+func requestLang(c *fiber.Ctx) string {
+	if c.AcceptsLanguages("id", "en") == "en" {
+		return "en"
+	}
+	return "id"
+}
+
+// checkNewPassword applies the password policy, the user's recent passwords
+// and the breached-password list to a new password. user may be an account
+// that is not saved yet.
+func checkNewPassword(cfg *config.Config, user *models.User, password string) *utils.PasswordError {
+	if perr := utils.CheckPasswordPolicy(cfg, password, user.Email, user.Nama); perr != nil {
+		return perr
+	}
+
+	if user.ID != 0 && cfg.PasswordHistory > 0 {
+		hashes := []string{user.Password}
+		var old []models.PasswordHistory
+		database.DB.Where("user_id = ?", user.ID).Order("id desc").Limit(cfg.PasswordHistory).Find(&old)
+		for _, h := range old {
+			hashes = append(hashes, h.Hash)
+		}
+		for _, h := range hashes {
+			if utils.Check(password, h) {
+				return utils.ErrPasswordReused
+			}
+		}
+	}
+
+	breached, err := utils.PasswordBreached(cfg.PasswordBreachDir, password)
+	if err != nil {
+		// A broken list must not stop people from changing passwords.
+		log.Printf("[Password] breach list lookup failed: %v", err)
+	}
+	if breached {
+		return utils.ErrPasswordBreached
+	}
+	return nil
+}
+
+// passwordRejected answers 400 with the localized policy message; data.reason
+// carries the stable code for clients.
+func passwordRejected(c *fiber.Ctx, perr *utils.PasswordError) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"code":    "400",
+		"message": perr.Message(requestLang(c)),
+		"data":    fiber.Map{"reason": perr.Code},
+		"success": false,
+	})
+}
+
+// savePasswordHistory records a newly set password hash and drops the rows
+// beyond the configured history length.
+func savePasswordHistory(cfg *config.Config, userID uint64, hash string) {
+	if cfg.PasswordHistory <= 0 || hash == "" {
+		return
+	}
+	if err := database.DB.Create(&models.PasswordHistory{UserID: userID, Hash: hash}).Error; err != nil {
+		log.Printf("[Password] failed to save history: %v", err)
+		return
+	}
+	var ids []uint64
+	database.DB.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id desc").Offset(cfg.PasswordHistory).Limit(1).Pluck("id", &ids)
+	if len(ids) > 0 {
+		database.DB.Where("user_id = ? AND id <= ?", userID, ids[0]).Delete(&models.PasswordHistory{})
+	}
+}
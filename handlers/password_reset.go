@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
 	"autentikasi/config"
 	"autentikasi/database"
@@ -27,6 +28,7 @@ func ForgotPassword(c *fiber.Ctx) error {
 			"success": false,
 		})
 	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
 
 	// Validate email format
 	if req.Email == "" {
@@ -47,14 +49,23 @@ func ForgotPassword(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate OTP
-	otp := utils.GenerateOTP()
+	// Generate OTP; only its hash is stored
+	otp, err := utils.GenerateOTP()
+	if err != nil {
+		log.Printf("[ForgotPassword] Failed to generate OTP: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code":    "500",
+			"message": "Failed to generate OTP",
+			"success": false,
+		})
+	}
+	otpHash := utils.HashCode(otp)
 	expiresAt := time.Now().Add(15 * time.Minute)
 
 	// Save OTP to database
 	passwordReset := models.PasswordReset{
 		Email:     req.Email,
-		OTP:       otp,
+		OTPHash:   otpHash,
 		ExpiresAt: expiresAt,
 	}
 
@@ -94,7 +105,7 @@ func ForgotPassword(c *fiber.Ctx) error {
 	})
 }
 
-// VerifyOTP - Step 2: Verify OTP
+// VerifyOTP - Step 2: Verify OTP and exchange it for a reset token
 // POST /api/v1/auth/verify-otp
 func VerifyOTP(c *fiber.Ctx) error {
 	var req dto.VerifyOTPRequest
@@ -105,6 +116,7 @@ func VerifyOTP(c *fiber.Ctx) error {
 			"success": false,
 		})
 	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
 
 	// Validate inputs
 	if req.Email == "" || req.OTP == "" {
@@ -115,31 +127,72 @@ func VerifyOTP(c *fiber.Ctx) error {
 		})
 	}
 
+	ipKey := ipThrottle("otp", c)
+	if wait, err := throttleRetryAfter(accountThrottle("otp", req.Email, 0), ipKey); err != nil {
+		return throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
 	// Check if user exists
 	var user models.User
 	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		throttleFailure(ipKey)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"code":    "404",
 			"message": "Email not found",
 			"success": false,
 		})
 	}
+	acctKey := accountThrottle("otp", req.Email, user.ID)
 
-	// Find OTP record
-	var pwReset models.PasswordReset
-	if err := database.DB.Where("email = ? AND otp = ?", req.Email, req.OTP).First(&pwReset).Error; err != nil {
+	// Find and check OTP record
+	pwReset, msg := checkResetOTP(req.Email, req.OTP)
+	if msg != "" {
+		throttleFailure(acctKey, ipKey)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"code":    "401",
-			"message": "Invalid OTP",
+			"message": msg,
 			"success": false,
 		})
 	}
+	throttleSuccess(acctKey)
 
-	// Check if OTP is expired
-	if time.Now().After(pwReset.ExpiresAt) {
+	// Exchange the OTP for a single-use reset token. The OTP itself is
+	// consumed here and cannot be verified again.
+	cfg := config.Load()
+	resetToken, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code":    "500",
+			"message": "Failed to verify OTP",
+			"success": false,
+		})
+	}
+	now := time.Now()
+	tokenHash := utils.HashToken(resetToken)
+	tokenExpiresAt := now.Add(cfg.ResetTokenTTL)
+	// Only the first correct submission gets a token; one that lost the
+	// race, or whose record was deleted meanwhile, stored nothing.
+	res := database.DB.Model(&models.PasswordReset{}).
+		Where("id = ? AND verified_at IS NULL", pwReset.ID).
+		Updates(models.PasswordReset{
+			VerifiedAt:          &now,
+			ResetTokenHash:      &tokenHash,
+			ResetTokenExpiresAt: &tokenExpiresAt,
+		})
+	if res.Error != nil {
+		log.Printf("[VerifyOTP] Failed to store reset token: %v", res.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"code":    "500",
+			"message": "Failed to verify OTP",
+			"success": false,
+		})
+	}
+	if res.RowsAffected == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"code":    "401",
-			"message": "OTP has expired",
+			"message": "Invalid OTP",
 			"success": false,
 		})
 	}
@@ -151,13 +204,14 @@ func VerifyOTP(c *fiber.Ctx) error {
 		"message": "OTP verified successfully",
 		"success": true,
 		"data": fiber.Map{
-			"email": req.Email,
-			"otp":   req.OTP,
+			"email":       req.Email,
+			"reset_token": resetToken,
+			"expires_in":  int64(cfg.ResetTokenTTL.Seconds()),
 		},
 	})
 }
 
-// ResetPassword - Step 3: Reset password with valid OTP
+// ResetPassword - Step 3: Reset password with the reset token from VerifyOTP
 // POST /api/v1/auth/reset-password
 func ResetPassword(c *fiber.Ctx) error {
 	cfg := c.Locals("config").(*config.Config)
@@ -170,20 +224,13 @@ func ResetPassword(c *fiber.Ctx) error {
 			"success": false,
 		})
 	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
 
 	// Validate inputs
-	if req.Email == "" || req.OTP == "" || req.Password == "" {
+	if req.Email == "" || req.ResetToken == "" || req.Password == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"code":    "400",
-			"message": "Email, OTP, and password are required",
-			"success": false,
-		})
-	}
-
-	if len(req.Password) < 6 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"code":    "400",
-			"message": "Password must be at least 6 characters",
+			"message": "Email, reset token, and password are required",
 			"success": false,
 		})
 	}
@@ -198,27 +245,44 @@ func ResetPassword(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find and validate OTP record
+	// Find and validate the reset token issued by VerifyOTP
 	var pwReset models.PasswordReset
-	if err := database.DB.Where("email = ? AND otp = ?", req.Email, req.OTP).First(&pwReset).Error; err != nil {
+	if err := database.DB.Where("email = ? AND reset_token_hash = ? AND verified_at IS NOT NULL",
+		req.Email, utils.HashToken(req.ResetToken)).First(&pwReset).Error; err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"code":    "401",
-			"message": "Invalid OTP",
+			"message": "Invalid reset token",
 			"success": false,
 		})
 	}
 
-	// Check if OTP is expired
-	if time.Now().After(pwReset.ExpiresAt) {
+	// Check if reset token is expired
+	if pwReset.ResetTokenExpiresAt == nil || time.Now().After(*pwReset.ResetTokenExpiresAt) {
+		database.DB.Delete(&pwReset)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"code":    "401",
-			"message": "OTP has expired",
+			"message": "Reset token has expired",
+			"success": false,
+		})
+	}
+
+	// The policy needs the account (name, old passwords), so it is checked
+	// here; a rejected password keeps the reset token usable for a retry.
+	if perr := checkNewPassword(cfg, &user, req.Password); perr != nil {
+		return passwordRejected(c, perr)
+	}
+
+	// Consume the token before changing anything so it cannot be replayed
+	if res := database.DB.Delete(&pwReset); res.Error != nil || res.RowsAffected == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"code":    "401",
+			"message": "Invalid reset token",
 			"success": false,
 		})
 	}
 
 	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.Hash(req.Password)
 	if err != nil {
 		log.Printf("[ResetPassword] Failed to hash password: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -229,7 +293,7 @@ func ResetPassword(c *fiber.Ctx) error {
 	}
 
 	// Update user password
-	if err := database.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+	if err := database.DB.Model(&user).Update("password", hashedPassword).Error; err != nil {
 		log.Printf("[ResetPassword] Failed to update password: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"code":    "500",
@@ -237,9 +301,18 @@ func ResetPassword(c *fiber.Ctx) error {
 			"success": false,
 		})
 	}
+	savePasswordHistory(cfg, user.ID, hashedPassword)
+	// A new password satisfies a reset forced by an admin
+	if user.Locked() {
+		if err := setAccountState(c, &user, user.UsableState(), "password reset", nil); err != nil {
+			log.Printf("[ResetPassword] Failed to unlock account: %v", err)
+		}
+	}
 
-	// Delete OTP record
-	database.DB.Delete(&pwReset)
+	// Whoever knew the old password must not stay logged in
+	if _, err := revokeUserSessions(user.ID, 0, "password_reset"); err != nil {
+		log.Printf("[ResetPassword] Failed to revoke sessions: %v", err)
+	}
 
 	// Send confirmation email
 	if err := utils.SendPasswordResetSuccessEmail(cfg, req.Email); err != nil {
@@ -272,3 +345,43 @@ func ResetPassword(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// checkResetOTP compares otp with the latest reset record for email and
+// returns the record, or a non-empty error message. Every guess reserves one
+// of the record's OTPMaxAttempts before it is compared, so parallel guesses
+// cannot all be compared before the limit is reached; once the attempts are
+// used up the OTP is invalidated and the 6-digit code cannot be
+// brute-forced within its lifetime.
+func checkResetOTP(email, otp string) (*models.PasswordReset, string) {
+	var pwReset models.PasswordReset
+	if err := database.DB.Where("email = ? AND verified_at IS NULL", email).Order("id desc").First(&pwReset).Error; err != nil {
+		return nil, "Invalid OTP"
+	}
+
+	// Check if OTP is expired
+	if time.Now().After(pwReset.ExpiresAt) {
+		return nil, "OTP has expired"
+	}
+
+	maxAttempts := config.Load().OTPMaxAttempts
+	res := database.DB.Model(&models.PasswordReset{}).
+		Where("id = ? AND verified_at IS NULL AND attempts < ?", pwReset.ID, maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return nil, "Invalid OTP"
+	}
+	if res.RowsAffected == 0 {
+		database.DB.Where("id = ? AND verified_at IS NULL", pwReset.ID).Delete(&models.PasswordReset{})
+		return nil, "Too many wrong OTP attempts, please request a new OTP"
+	}
+
+	if !utils.CheckCode(otp, pwReset.OTPHash) {
+		// The record is left for the next guess to delete: a parallel
+		// guess holding an earlier reservation may still be the right one.
+		if err := database.DB.Select("attempts").Take(&pwReset, pwReset.ID).Error; err == nil && pwReset.Attempts >= maxAttempts {
+			return nil, "Too many wrong OTP attempts, please request a new OTP"
+		}
+		return nil, "Invalid OTP"
+	}
+	return &pwReset, ""
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// errPinLocked is returned by checkPin while the PIN is locked out.
+var errPinLocked = errors.New("PIN locked")
+
+// SetPin - set the transaction PIN, or replace a forgotten one, using the password
+// POST /api/v1/auth/pin
+func SetPin(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.SetPinRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if ok, err := verifyPassword(c, user, body.Password, "Kata sandi kamu salah"); !ok {
+		return err
+	}
+	if !validPin(body.Pin) {
+		return utils.Fail(c, fiber.StatusBadRequest, "PIN harus 4-6 digit angka")
+	}
+
+	if err := savePin(user, body.Pin); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal menyimpan PIN")
+	}
+	recordEvent(c, user.ID, "pin_set", "Transaction PIN set", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "PIN saved"})
+}
+
+// ChangePin - change the transaction PIN using the current one
+// PUT /api/v1/auth/pin
+func ChangePin(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.ChangePinRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if !validPin(body.Pin) {
+		return utils.Fail(c, fiber.StatusBadRequest, "PIN harus 4-6 digit angka")
+	}
+	if err := checkPin(user, body.CurrentPin); err != nil {
+		return pinFailure(c, user, err)
+	}
+
+	if err := savePin(user, body.Pin); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Gagal menyimpan PIN")
+	}
+	recordEvent(c, user.ID, "pin_change", "Transaction PIN changed", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "PIN changed"})
+}
+
+// VerifyPin - step-up: confirm the PIN and receive a short-lived elevated
+// token to send as X-Elevated-Token on sensitive requests
+// POST /api/v1/auth/pin/verify
+func VerifyPin(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	sess, ok := c.Locals("session").(*models.Session)
+	if !ok || sess == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.VerifyPinRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := checkPin(user, body.Pin); err != nil {
+		return pinFailure(c, user, err)
+	}
+
+	cfg := config.Load()
+	claims, err := utils.NewClaims(utils.TokenElevated, user.ID, nil, cfg.ElevatedTokenTTL)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	claims.SessionID = sess.ID
+	token, err := utils.SignJWT(claims)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"elevated_token": token,
+		"expires_in":     int64(cfg.ElevatedTokenTTL.Seconds()),
+	})
+}
+
+// checkPin verifies pin for user and maintains the wrong-guess counter.
+// After PinMaxAttempts wrong guesses the PIN is locked for PinLockDuration.
+//
+// The check runs on the stored row, locked for the duration: parallel
+// guesses are counted one after the other and none of them gets past a
+// lockout another one caused.
+func checkPin(user *models.User, pin string) error {
+	cfg := config.Load()
+	var result error
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var row models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "pin", "pin_failed_attempts", "pin_locked_until").
+			First(&row, user.ID).Error; err != nil {
+			return err
+		}
+		user.Pin, user.PinFailedAttempts, user.PinLockedUntil = row.Pin, row.PinFailedAttempts, row.PinLockedUntil
+
+		now := time.Now()
+		if row.PinLockedUntil != nil && now.Before(*row.PinLockedUntil) {
+			result = errPinLocked
+			return nil
+		}
+		if row.Pin == nil || *row.Pin == "" {
+			result = errors.New("PIN belum diatur")
+			return nil
+		}
+
+		if utils.Check(pin, *row.Pin) {
+			user.PinFailedAttempts = 0
+			user.PinLockedUntil = nil
+			if row.PinFailedAttempts == 0 && row.PinLockedUntil == nil {
+				return nil
+			}
+			return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"pin_failed_attempts": 0,
+				"pin_locked_until":    nil,
+			}).Error
+		}
+
+		attempts := row.PinFailedAttempts + 1
+		updates := map[string]interface{}{"pin_failed_attempts": attempts}
+		result = errors.New("PIN salah")
+		if attempts >= cfg.PinMaxAttempts {
+			until := now.Add(cfg.PinLockDuration)
+			attempts = 0
+			updates["pin_failed_attempts"] = 0
+			updates["pin_locked_until"] = until
+			user.PinLockedUntil = &until
+			result = errPinLocked
+			recordHistory(user.ID, "pin_locked", fmt.Sprintf("PIN locked after %d wrong attempts", cfg.PinMaxAttempts))
+		}
+		user.PinFailedAttempts = attempts
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return errors.New("Gagal memeriksa PIN")
+	}
+	return result
+}
+
+// pinFailure turns a checkPin error into the HTTP response.
+func pinFailure(c *fiber.Ctx, user *models.User, err error) error {
+	if errors.Is(err, errPinLocked) {
+		retry := time.Until(*user.PinLockedUntil)
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retry.Seconds())+1))
+		return utils.Fail(c, fiber.StatusTooManyRequests, "PIN terkunci, coba lagi nanti")
+	}
+	return utils.Fail(c, fiber.StatusUnauthorized, err.Error())
+}
+
+func savePin(user *models.User, pin string) error {
+	hashPin, err := utils.Hash(pin)
+	if err != nil {
+		return err
+	}
+	user.Pin = &hashPin
+	user.PinFailedAttempts = 0
+	user.PinLockedUntil = nil
+	return database.DB.Model(user).Updates(map[string]interface{}{
+		"pin":                 hashPin,
+		"pin_failed_attempts": 0,
+		"pin_locked_until":    nil,
+	}).Error
+}
+
+// validPin accepts 4 to 6 digits.
+func validPin(pin string) bool {
+	if len(pin) < 4 || len(pin) > 6 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
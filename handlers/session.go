@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// startSession persists a new session for user and returns the token pair
+// that is handed to the client after a successful login. deviceName falls
+// back to the X-Device-Name header when the client did not send one;
+// clientID must already be resolved by resolveClientID.
+func startSession(c *fiber.Ctx, user *models.User, deviceName, clientID string) (fiber.Map, error) {
+	cfg := config.Load()
+	if strings.TrimSpace(deviceName) == "" {
+		deviceName = c.Get("X-Device-Name")
+	}
+	now := time.Now()
+	sess := models.Session{
+		UserID:     user.ID,
+		ClientID:   clientID,
+		DeviceName: truncate(strings.TrimSpace(deviceName), 100),
+		UserAgent:  truncate(c.Get(fiber.HeaderUserAgent), 255),
+		IP:         c.IP(),
+		LastSeenAt: &now,
+		ExpiresAt:  now.Add(cfg.RefreshTokenTTL),
+	}
+	if err := database.DB.Create(&sess).Error; err != nil {
+		return nil, err
+	}
+	return issueTokenPair(cfg, user, &sess)
+}
+
+// resolveClientID picks the audience for a new session from the request
+// body or the X-Client-ID header and checks it against JWT_AUDIENCES.
+func resolveClientID(c *fiber.Ctx, requested string) (string, bool) {
+	if requested == "" {
+		requested = c.Get("X-Client-ID")
+	}
+	audiences := config.Load().JWTAudiences
+	if requested == "" {
+		return audiences[0], true
+	}
+	for _, aud := range audiences {
+		if aud == requested {
+			return requested, true
+		}
+	}
+	return "", false
+}
+
+// issueTokenPair signs a fresh access token and a new refresh token for sess.
+func issueTokenPair(cfg *config.Config, user *models.User, sess *models.Session) (fiber.Map, error) {
+	refresh, err := newRefreshToken(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := sess.ClientID
+	if clientID == "" {
+		clientID = cfg.JWTAudiences[0]
+	}
+	claims, err := utils.NewClaims(utils.TokenAccess, user.ID, []string{clientID}, cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	claims.SessionID = sess.ID
+	claims.Email = user.Email
+	claims.Nama = user.Nama
+	token, err := utils.SignJWT(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"token":         token,
+		"token_type":    "Bearer",
+		"expires_in":    int64(cfg.AccessTokenTTL.Seconds()),
+		"refresh_token": refresh,
+	}, nil
+}
+
+// newRefreshToken stores and returns a new refresh token for sess.
+func newRefreshToken(sess *models.Session) (string, error) {
+	refresh, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	rt := models.RefreshToken{
+		SessionID: sess.ID,
+		UserID:    sess.UserID,
+		TokenHash: utils.HashToken(refresh),
+		ExpiresAt: sess.ExpiresAt,
+	}
+	if err := database.DB.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return refresh, nil
+}
+
+// denylistToken revokes one token by jti until its natural expiry.
+func denylistToken(claims *utils.Claims, reason string) error {
+	if claims == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	// opportunistically prune entries for tokens that have expired anyway
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	return database.DB.Where(models.RevokedToken{JTI: claims.ID}).FirstOrCreate(&models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID(),
+		Reason:    reason,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}).Error
+}
+
+// RevokeToken - denylist a single access token of the current user (e.g.
+// one that leaked from a device that is still otherwise trusted)
+// POST /api/v1/auth/tokens/revoke
+func RevokeToken(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	var body dto.RevokeTokenRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	claims, err := utils.ParseJWT(body.Token, config.Load().JWTAudiences...)
+	if err != nil || claims.UserID() != user.ID {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid token")
+	}
+	if err := denylistToken(claims, "revoked_by_user"); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke token")
+	}
+	recordEvent(c, user.ID, "token_revoked", "Access token "+claims.ID+" revoked", nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Token revoked", "jti": claims.ID})
+}
+
+// revokeSession marks sess as revoked. Access tokens carrying its id are
+// rejected by JWTProtected and its refresh tokens can no longer be rotated.
+func revokeSession(sess *models.Session, reason string) error {
+	if sess.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	sess.RevokedAt = &now
+	sess.RevokeReason = reason
+	return database.DB.Model(sess).Updates(map[string]interface{}{
+		"revoked_at":    now,
+		"revoke_reason": reason,
+	}).Error
+}
+
+var (
+	errRefreshInvalid  = errors.New("invalid refresh token")
+	errSessionInactive = errors.New("session expired or revoked")
+	errRefreshReused   = errors.New("refresh token reused")
+)
+
+// rotateRefreshToken marks raw as used and returns its session, which must
+// satisfy accept. A token that was already rotated revokes the session and
+// returns errRefreshReused.
+func rotateRefreshToken(raw string, accept func(*models.Session) bool) (*models.Session, error) {
+	var rt models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&rt).Error; err != nil {
+		return nil, errRefreshInvalid
+	}
+
+	var sess models.Session
+	if err := database.DB.First(&sess, rt.SessionID).Error; err != nil || !accept(&sess) {
+		return nil, errRefreshInvalid
+	}
+	now := time.Now()
+	if !sess.Active(now) {
+		return nil, errSessionInactive
+	}
+
+	err := func() error {
+		if rt.UsedAt != nil {
+			return errRefreshReused
+		}
+		if now.After(rt.ExpiresAt) {
+			return errRefreshInvalid
+		}
+		// Conditional update so two concurrent rotations cannot both succeed.
+		res := database.DB.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshReused
+		}
+		return nil
+	}()
+	if errors.Is(err, errRefreshReused) {
+		// A rotated token came back: assume it was stolen and kill the family.
+		if err := revokeSession(&sess, "refresh_token_reuse"); err != nil {
+			return nil, err
+		}
+		recordHistory(sess.UserID, "refresh_token_reuse", "Refresh token reuse detected; session revoked")
+		return nil, errRefreshReused
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Refresh - rotate a refresh token and issue a new access token
+// POST /api/v1/auth/refresh
+func Refresh(c *fiber.Ctx) error {
+	var body dto.RefreshRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	if strings.TrimSpace(body.RefreshToken) == "" {
+		return utils.Fail(c, fiber.StatusBadRequest, "Refresh token wajib diisi")
+	}
+
+	// Sessions of OAuth clients are refreshed through /oauth/token.
+	sess, err := rotateRefreshToken(body.RefreshToken, func(s *models.Session) bool { return s.Scope == "" })
+	switch {
+	case errors.Is(err, errRefreshReused):
+		return utils.Fail(c, fiber.StatusUnauthorized, "Refresh token already used")
+	case errors.Is(err, errSessionInactive):
+		return utils.Fail(c, fiber.StatusUnauthorized, "Session expired or revoked")
+	case err != nil:
+		return utils.Fail(c, fiber.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, sess.UserID).Error; err != nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "User not found")
+	}
+	if msg := loginBlocked(&user); msg != "" {
+		return utils.Fail(c, fiber.StatusForbidden, msg)
+	}
+
+	database.DB.Model(sess).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": c.IP()})
+
+	tokens, err := issueTokenPair(config.Load(), &user, sess)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to sign token")
+	}
+	return utils.Ok(c, fiber.StatusOK, tokens)
+}
+
+// ListSessions - list active sessions (devices) of the current user
+// GET /api/v1/auth/sessions
+func ListSessions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	current, _ := c.Locals("session").(*models.Session)
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch sessions")
+	}
+
+	items := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, fiber.Map{
+			"id":           s.ID,
+			"device_name":  s.DeviceName,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_seen_at": s.LastSeenAt,
+			"current":      current != nil && current.ID == s.ID,
+		})
+	}
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"sessions": items})
+}
+
+// RevokeSession - log out a single device
+// DELETE /api/v1/auth/sessions/:id
+func RevokeSession(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, "Invalid session ID")
+	}
+
+	var sess models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).First(&sess).Error; err != nil {
+		return utils.Fail(c, fiber.StatusNotFound, "Session not found")
+	}
+	if err := revokeSession(&sess, "revoked_by_user"); err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke session")
+	}
+	recordEvent(c, user.ID, "session_revoked", fmt.Sprintf("Session #%d (%s) revoked", sess.ID, sessionLabel(&sess)), nil)
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions - log out everywhere except the current device
+// DELETE /api/v1/auth/sessions
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	var keepID uint64
+	if current, ok := c.Locals("session").(*models.Session); ok && current != nil {
+		keepID = current.ID
+	}
+
+	n, err := revokeUserSessions(user.ID, keepID, "revoked_by_user")
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to revoke sessions")
+	}
+	if n > 0 {
+		recordEvent(c, user.ID, "session_revoked", fmt.Sprintf("%d other session(s) revoked", n), nil)
+	}
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Other sessions revoked", "revoked": n})
+}
+
+// revokeUserSessions revokes every active session of userID except keepID
+// (pass 0 to revoke all of them) and returns how many were revoked.
+func revokeUserSessions(userID, keepID uint64, reason string) (int64, error) {
+	res := database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason})
+	return res.RowsAffected, res.Error
+}
+
+// sessionLabel returns a short human readable description of a session.
+func sessionLabel(s *models.Session) string {
+	if s.DeviceName != "" {
+		return s.DeviceName
+	}
+	if s.UserAgent != "" {
+		return s.UserAgent
+	}
+	return s.IP
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
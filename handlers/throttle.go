@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// throttleKey identifies one failed-attempt counter. Limit is the number of
+// failures allowed before backoff starts. UserID is set on per-account keys
+// so lockouts and unlocks are written to the account history.
+type throttleKey struct {
+	Key    string
+	Limit  int
+	UserID uint64
+}
+
+func accountThrottle(scope, account string, userID uint64) throttleKey {
+	return throttleKey{Key: models.AccountThrottleKey(scope, account), Limit: config.Load().AccountMaxAttempts, UserID: userID}
+}
+
+func ipThrottle(scope string, c *fiber.Ctx) throttleKey {
+	return throttleKey{Key: scope + ":ip:" + c.IP(), Limit: config.Load().IPMaxAttempts}
+}
+
+// throttleRetryAfter returns how long the caller has to wait before another
+// attempt is accepted for any of keys, or 0 when none of them is locked. An
+// error means the locks could not be read; the attempt must be refused with
+// throttleUnavailable, not let through.
+func throttleRetryAfter(keys ...throttleKey) (time.Duration, error) {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.Key)
+	}
+	var rows []models.AuthThrottle
+	if err := database.DB.Where("`key` IN ? AND locked_until > ?", names, time.Now()).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, r := range rows {
+		if d := time.Until(*r.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// throttleFailure counts a failed attempt against every key. Each failure at
+// or past the key's limit locks it for LockoutBase doubled per extra failure,
+// capped at LockoutMax.
+func throttleFailure(keys ...throttleKey) {
+	cfg := config.Load()
+	now := time.Now()
+	for _, k := range keys {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			row := models.AuthThrottle{Key: k.Key, UserID: k.UserID}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where(models.AuthThrottle{Key: k.Key}).FirstOrCreate(&row).Error; err != nil {
+				return err
+			}
+
+			// A quiet period forgets old failures.
+			if row.LastFailureAt != nil && now.Sub(*row.LastFailureAt) > cfg.ThrottleWindow &&
+				(row.LockedUntil == nil || now.After(*row.LockedUntil)) {
+				row.Failures = 0
+			}
+			row.Failures++
+			row.LastFailureAt = &now
+			if k.UserID != 0 {
+				row.UserID = k.UserID
+			}
+
+			if row.Failures >= k.Limit {
+				lock := cfg.LockoutBase << uint(min(row.Failures-k.Limit, 20))
+				if lock > cfg.LockoutMax || lock <= 0 {
+					lock = cfg.LockoutMax
+				}
+				until := now.Add(lock)
+				row.LockedUntil = &until
+				if row.UserID != 0 {
+					recordHistory(row.UserID, "account_locked",
+						fmt.Sprintf("Locked for %s after %d failed attempts (%s)", lock.Round(time.Second), row.Failures, k.Key))
+				}
+			}
+			return tx.Save(&row).Error
+		})
+		if err != nil {
+			log.Printf("[Throttle] failed to update %s: %v", k.Key, err)
+		}
+	}
+}
+
+// throttleSuccess clears the counters for keys after a successful attempt.
+func throttleSuccess(keys ...throttleKey) {
+	for _, k := range keys {
+		var row models.AuthThrottle
+		if err := database.DB.Where("`key` = ?", k.Key).First(&row).Error; err != nil {
+			continue
+		}
+		if err := database.DB.Delete(&row).Error; err != nil {
+			log.Printf("[Throttle] failed to update %s: %v", k.Key, err)
+			continue
+		}
+		if row.UserID != 0 && row.LockedUntil != nil {
+			recordHistory(row.UserID, "account_unlocked", "Failed attempt counter cleared after successful sign-in ("+k.Key+")")
+		}
+	}
+}
+
+// verifyPassword checks the password of a logged-in user before a sensitive
+// change. Wrong guesses are throttled per account and per IP, as at login.
+// When it returns false the response has been written; return the error.
+func verifyPassword(c *fiber.Ctx, user *models.User, password, wrongMsg string) (bool, error) {
+	acctKey := accountThrottle("password", strconv.FormatUint(user.ID, 10), user.ID)
+	ipKey := ipThrottle("password", c)
+	if wait, err := throttleRetryAfter(acctKey, ipKey); err != nil {
+		return false, throttleUnavailable(c, err)
+	} else if wait > 0 {
+		return false, tooManyAttempts(c, wait)
+	}
+	if !utils.Check(password, user.Password) {
+		throttleFailure(acctKey, ipKey)
+		return false, utils.Fail(c, fiber.StatusUnauthorized, wrongMsg)
+	}
+	throttleSuccess(acctKey)
+	return true, nil
+}
+
+// throttleUnavailable answers 503 when the throttle state cannot be read.
+func throttleUnavailable(c *fiber.Ctx, err error) error {
+	log.Printf("[Throttle] failed to read locks: %v", err)
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"code":    "503",
+		"message": "Layanan sedang tidak tersedia, coba lagi nanti",
+		"data":    nil,
+		"success": false,
+	})
+}
+
+// tooManyAttempts answers 429 with a Retry-After header in whole seconds.
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	secs := int(wait.Seconds()) + 1
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(secs))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"code":    "429",
+		"message": fmt.Sprintf("Terlalu banyak percobaan, coba lagi dalam %d detik", secs),
+		"data":    fiber.Map{"retry_after": secs},
+		"success": false,
+	})
+}
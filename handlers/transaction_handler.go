@@ -1,13 +1,70 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"autentikasi/config"
 	"autentikasi/database"
+	"autentikasi/dto"
+	"autentikasi/middleware"
 	"autentikasi/models"
 	"autentikasi/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// validateTransaction checks a transaction before it is saved and returns
+// what is wrong with it, or "" when it is valid.
+func validateTransaction(cfg *config.Config, tx *models.Transaction) string {
+	valid := false
+	for _, k := range models.TransactionKinds {
+		if tx.Jenis == k {
+			valid = true
+		}
+	}
+	if !valid {
+		return "Jenis transaksi harus " + strings.Join(models.TransactionKinds, ", ")
+	}
+	if tx.Jumlah <= 0 {
+		return "Jumlah harus lebih dari 0"
+	}
+	if tx.Jumlah > cfg.TransactionMaxAmount {
+		return "Jumlah maksimal " + cfg.TransactionMaxAmount.String()
+	}
+	if utf8.RuneCountInString(tx.Metode) > 100 {
+		return "Metode maksimal 100 karakter"
+	}
+	if utf8.RuneCountInString(tx.Kategori) > 50 {
+		return "Kategori maksimal 50 karakter"
+	}
+	if utf8.RuneCountInString(tx.Keterangan) > 255 {
+		return "Keterangan maksimal 255 karakter"
+	}
+	return ""
+}
+
+// ownTransaction loads transaction :id of the current user. Other users'
+// transactions are reported as not found. unscoped also finds deleted ones.
+func ownTransaction(c *fiber.Ctx, user *models.User, unscoped bool) (*models.Transaction, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, utils.Fail(c, fiber.StatusBadRequest, "Invalid transaction ID")
+	}
+	db := database.DB
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var tx models.Transaction
+	if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&tx).Error; err != nil {
+		return nil, utils.Fail(c, fiber.StatusNotFound, "Transaction not found")
+	}
+	return &tx, nil
+}
+
 // CreateTransaction creates a new transaction for the authorized user
 func CreateTransaction(c *fiber.Ctx) error {
 	user, ok := c.Locals("user").(*models.User)
@@ -15,41 +72,248 @@ func CreateTransaction(c *fiber.Ctx) error {
 		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
 	}
 
-	var body struct {
-		Jenis      string  `json:"jenis"`
-		Jumlah     float64 `json:"jumlah"`
-		Metode     string  `json:"metode"`
-		Keterangan string  `json:"keterangan"`
-	}
+	var body dto.TransactionRequest
 	if err := c.BodyParser(&body); err != nil {
 		return utils.Fail(c, fiber.StatusBadRequest, "Invalid body")
 	}
 
 	tx := models.Transaction{
 		UserID:     user.ID,
-		Jenis:      body.Jenis,
+		Jenis:      strings.TrimSpace(body.Jenis),
 		Jumlah:     body.Jumlah,
-		Metode:     body.Metode,
-		Keterangan: body.Keterangan,
+		Metode:     strings.TrimSpace(body.Metode),
+		Kategori:   strings.TrimSpace(body.Kategori),
+		Keterangan: strings.TrimSpace(body.Keterangan),
+	}
+	cfg := config.Load()
+	if msg := validateTransaction(cfg, &tx); msg != "" {
+		return utils.Fail(c, fiber.StatusBadRequest, msg)
 	}
+	if tx.Jumlah >= cfg.LargeTransactionAmount && !middleware.IsElevated(c) {
+		return utils.Fail(c, fiber.StatusForbidden, "Verifikasi PIN diperlukan untuk transaksi besar")
+	}
+
 	if err := database.DB.Create(&tx).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to create transaction")
 	}
+	recordEvent(c, user.ID, "transaction_created", fmt.Sprintf("Transaction #%d (%s) created", tx.ID, tx.Jenis), fiber.Map{
+		"transaction_id": tx.ID,
+		"jenis":          tx.Jenis,
+		"jumlah":         tx.Jumlah,
+		"metode":         tx.Metode,
+	})
 
 	return utils.Ok(c, fiber.StatusCreated, tx)
 }
 
-// ListTransactions returns transactions of the authenticated user
+// ListTransactions returns a page of the authenticated user's transactions
+// with the totals of every transaction matching the filters (see
+// transactionQuery). sort is created_at or jumlah, "-" first for descending;
+// pass next_cursor of the previous page as cursor for the next one.
+// GET /api/v1/transactions
 func ListTransactions(c *fiber.Ctx) error {
 	user, ok := c.Locals("user").(*models.User)
 	if !ok || user == nil {
 		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
 	}
 
+	db, err := transactionQuery(c, user.ID)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+	}
+	sort := c.Query("sort", transactionDefaultSort)
+	column, desc, err := parseTransactionSort(sort)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+	}
+	limit := c.QueryInt("limit", transactionDefaultLimit)
+	if limit < 1 || limit > transactionMaxLimit {
+		limit = transactionDefaultLimit
+	}
+	// The page and the totals are two queries built on the same filters.
+	db = db.Session(&gorm.Session{})
+
+	totals, err := sumTransactions(db)
+	if err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch transactions")
+	}
+
+	page := db
+	if v := c.Query("cursor"); v != "" {
+		if page, err = afterTransactionCursor(page, v, sort, column, desc); err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, err.Error())
+		}
+	}
+	dir := " asc"
+	if desc {
+		dir = " desc"
+	}
 	var txs []models.Transaction
-	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at desc").Find(&txs).Error; err != nil {
+	if err := page.Order(column + dir).Order("id" + dir).Limit(limit + 1).Find(&txs).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to fetch transactions")
 	}
+	var next *string
+	if len(txs) > limit {
+		txs = txs[:limit]
+		cursor := encodeTransactionCursor(sort, &txs[limit-1])
+		next = &cursor
+	}
+
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{
+		"transactions": txs,
+		"next_cursor":  next,
+		"limit":        limit,
+		"totals":       totals,
+	})
+}
+
+// GetTransaction returns one transaction of the authenticated user
+// GET /api/v1/transactions/:id
+func GetTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tx, err := ownTransaction(c, user, false)
+	if tx == nil {
+		return err
+	}
+	return utils.Ok(c, fiber.StatusOK, tx)
+}
 
-	return utils.Ok(c, fiber.StatusOK, txs)
+// UpdateTransaction replaces a transaction (PUT) or changes only the fields
+// that are sent (PATCH). Raising the amount to LARGE_TRANSACTION_AMOUNT or
+// more needs PIN confirmation, like creating such a transaction.
+// PUT   /api/v1/transactions/:id
+// PATCH /api/v1/transactions/:id
+func UpdateTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tx, err := ownTransaction(c, user, false)
+	if tx == nil {
+		return err
+	}
+	before := *tx
+
+	if c.Method() == fiber.MethodPut {
+		var body dto.TransactionRequest
+		if err := c.BodyParser(&body); err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid body")
+		}
+		tx.Jenis = strings.TrimSpace(body.Jenis)
+		tx.Jumlah = body.Jumlah
+		tx.Metode = strings.TrimSpace(body.Metode)
+		tx.Kategori = strings.TrimSpace(body.Kategori)
+		tx.Keterangan = strings.TrimSpace(body.Keterangan)
+	} else {
+		var body dto.PatchTransactionRequest
+		if err := c.BodyParser(&body); err != nil {
+			return utils.Fail(c, fiber.StatusBadRequest, "Invalid body")
+		}
+		if body.Jenis != nil {
+			tx.Jenis = strings.TrimSpace(*body.Jenis)
+		}
+		if body.Jumlah != nil {
+			tx.Jumlah = *body.Jumlah
+		}
+		if body.Metode != nil {
+			tx.Metode = strings.TrimSpace(*body.Metode)
+		}
+		if body.Kategori != nil {
+			tx.Kategori = strings.TrimSpace(*body.Kategori)
+		}
+		if body.Keterangan != nil {
+			tx.Keterangan = strings.TrimSpace(*body.Keterangan)
+		}
+	}
+
+	cfg := config.Load()
+	if msg := validateTransaction(cfg, tx); msg != "" {
+		return utils.Fail(c, fiber.StatusBadRequest, msg)
+	}
+	if tx.Jumlah > before.Jumlah && tx.Jumlah >= cfg.LargeTransactionAmount && !middleware.IsElevated(c) {
+		return utils.Fail(c, fiber.StatusForbidden, "Verifikasi PIN diperlukan untuk transaksi besar")
+	}
+
+	changed := fiber.Map{}
+	if tx.Jenis != before.Jenis {
+		changed["jenis"] = fiber.Map{"from": before.Jenis, "to": tx.Jenis}
+	}
+	if tx.Jumlah != before.Jumlah {
+		changed["jumlah"] = fiber.Map{"from": before.Jumlah, "to": tx.Jumlah}
+	}
+	if tx.Metode != before.Metode {
+		changed["metode"] = fiber.Map{"from": before.Metode, "to": tx.Metode}
+	}
+	if tx.Kategori != before.Kategori {
+		changed["kategori"] = fiber.Map{"from": before.Kategori, "to": tx.Kategori}
+	}
+	if tx.Keterangan != before.Keterangan {
+		changed["keterangan"] = fiber.Map{"from": before.Keterangan, "to": tx.Keterangan}
+	}
+	if len(changed) == 0 {
+		return utils.Ok(c, fiber.StatusOK, tx)
+	}
+
+	if err := database.DB.Model(tx).Select("jenis", "jumlah_sen", "metode", "kategori", "keterangan").Updates(tx).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to update transaction")
+	}
+	recordEvent(c, user.ID, "transaction_updated", fmt.Sprintf("Transaction #%d updated", tx.ID), fiber.Map{
+		"transaction_id": tx.ID,
+		"changes":        changed,
+	})
+	return utils.Ok(c, fiber.StatusOK, tx)
+}
+
+// DeleteTransaction soft-deletes a transaction; it no longer counts towards
+// the balance and can be restored
+// DELETE /api/v1/transactions/:id
+func DeleteTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tx, err := ownTransaction(c, user, false)
+	if tx == nil {
+		return err
+	}
+	if err := database.DB.Delete(tx).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to delete transaction")
+	}
+	recordEvent(c, user.ID, "transaction_deleted", fmt.Sprintf("Transaction #%d (%s) deleted", tx.ID, tx.Jenis), fiber.Map{
+		"transaction_id": tx.ID,
+		"jenis":          tx.Jenis,
+		"jumlah":         tx.Jumlah,
+	})
+	return utils.Ok(c, fiber.StatusOK, fiber.Map{"message": "Transaction deleted", "id": tx.ID})
+}
+
+// RestoreTransaction brings back a deleted transaction. A large one needs
+// PIN confirmation, as when it was created.
+// POST /api/v1/transactions/:id/restore
+func RestoreTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return utils.Fail(c, fiber.StatusUnauthorized, "Unauthorized")
+	}
+	tx, err := ownTransaction(c, user, true)
+	if tx == nil {
+		return err
+	}
+	if !tx.DeletedAt.Valid {
+		return utils.Fail(c, fiber.StatusConflict, "Transaction is not deleted")
+	}
+	if tx.Jumlah >= config.Load().LargeTransactionAmount && !middleware.IsElevated(c) {
+		return utils.Fail(c, fiber.StatusForbidden, "Verifikasi PIN diperlukan untuk transaksi besar")
+	}
+	if err := database.DB.Unscoped().Model(tx).Update("deleted_at", gorm.Expr("NULL")).Error; err != nil {
+		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to restore transaction")
+	}
+	tx.DeletedAt = gorm.DeletedAt{}
+	recordEvent(c, user.ID, "transaction_restored", fmt.Sprintf("Transaction #%d (%s) restored", tx.ID, tx.Jenis), fiber.Map{
+		"transaction_id": tx.ID,
+	})
+	return utils.Ok(c, fiber.StatusOK, tx)
 }
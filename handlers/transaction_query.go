@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"autentikasi/database"
+	"autentikasi/models"
+)
+
+const (
+	transactionDefaultLimit = 20
+	transactionMaxLimit     = 100
+	transactionDefaultSort  = "-created_at"
+
+	// Words shorter than this are not in the FULLTEXT index (InnoDB's
+	// innodb_ft_min_token_size); searches containing one fall back to LIKE.
+	fulltextMinWord = 3
+)
+
+// transactionSorts maps the sort parameter to its column. A leading "-"
+// sorts descending.
+var transactionSorts = map[string]string{
+	"created_at": "created_at",
+	"jumlah":     "jumlah_sen",
+}
+
+// transactionTotals sums the transactions matching a list request,
+// independent of the page.
+type transactionTotals struct {
+	Income   models.Money `json:"income"`
+	Expense  models.Money `json:"expense"`
+	Transfer models.Money `json:"transfer"`
+	Net      models.Money `json:"net"`
+	Count    int64        `json:"count"`
+}
+
+// commaList splits a comma separated query parameter, dropping empty items.
+func commaList(v string) []string {
+	var items []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// transactionQuery applies the filters of a transaction list request: from
+// and to (see timeRange), jenis, metode and kategori (comma separated),
+// min_amount and max_amount, q (a search over keterangan) and deleted=true
+// (only deleted transactions, to find ones to restore).
+func transactionQuery(c *fiber.Ctx, userID uint64) (*gorm.DB, error) {
+	db := database.DB.Model(&models.Transaction{})
+	if c.QueryBool("deleted") {
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	db = db.Where("user_id = ?", userID)
+
+	db, err := timeRange(c, db, "created_at")
+	if err != nil {
+		return nil, err
+	}
+	if kinds := commaList(c.Query("jenis")); len(kinds) > 0 {
+		for _, k := range kinds {
+			valid := false
+			for _, known := range models.TransactionKinds {
+				if k == known {
+					valid = true
+				}
+			}
+			if !valid {
+				return nil, errors.New("Jenis transaksi harus " + strings.Join(models.TransactionKinds, ", "))
+			}
+		}
+		db = db.Where("jenis IN ?", kinds)
+	}
+	if methods := commaList(c.Query("metode")); len(methods) > 0 {
+		db = db.Where("metode IN ?", methods)
+	}
+	if categories := commaList(c.Query("kategori")); len(categories) > 0 {
+		db = db.Where("kategori IN ?", categories)
+	}
+	if v := c.Query("min_amount"); v != "" {
+		minAmount, err := models.ParseMoney(v)
+		if err != nil {
+			return nil, errors.New("Invalid min_amount")
+		}
+		db = db.Where("jumlah_sen >= ?", minAmount)
+	}
+	if v := c.Query("max_amount"); v != "" {
+		maxAmount, err := models.ParseMoney(v)
+		if err != nil {
+			return nil, errors.New("Invalid max_amount")
+		}
+		db = db.Where("jumlah_sen <= ?", maxAmount)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		if utf8.RuneCountInString(q) > 100 {
+			return nil, errors.New("Pencarian maksimal 100 karakter")
+		}
+		db = searchKeterangan(db, q)
+	}
+	return db, nil
+}
+
+// searchKeterangan matches transactions whose keterangan contains every
+// word of q, as a word prefix. It uses the FULLTEXT index unless one of the
+// words is too short to be indexed.
+func searchKeterangan(db *gorm.DB, q string) *gorm.DB {
+	// Strip the boolean-mode operators so user input is only ever words.
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return r == ' ' || strings.ContainsRune(`+-<>()~*"@`, r)
+	})
+	if len(words) == 0 {
+		return db
+	}
+	fulltext := true
+	for _, w := range words {
+		if utf8.RuneCountInString(w) < fulltextMinWord {
+			fulltext = false
+		}
+	}
+	if fulltext {
+		terms := make([]string, len(words))
+		for i, w := range words {
+			terms[i] = "+" + w + "*"
+		}
+		return db.Where("MATCH(keterangan) AGAINST(? IN BOOLEAN MODE)", strings.Join(terms, " "))
+	}
+	escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	for _, w := range words {
+		db = db.Where("keterangan LIKE ?", "%"+escape.Replace(w)+"%")
+	}
+	return db
+}
+
+// parseTransactionSort returns the column and direction of the sort
+// parameter.
+func parseTransactionSort(sort string) (column string, desc bool, err error) {
+	if sort == "" {
+		sort = transactionDefaultSort
+	}
+	desc = strings.HasPrefix(sort, "-")
+	column, ok := transactionSorts[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return "", false, errors.New("sort harus created_at, -created_at, jumlah atau -jumlah")
+	}
+	return column, desc, nil
+}
+
+// Transaction cursors hold the sort, the sort value and the ID of the last
+// transaction of a page; the ID breaks ties between equal values.
+
+func encodeTransactionCursor(sort string, tx *models.Transaction) string {
+	value := strconv.FormatInt(int64(tx.Jumlah), 10)
+	if strings.TrimPrefix(sort, "-") == "created_at" {
+		value = ""
+		if tx.CreatedAt != nil {
+			value = tx.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	raw := sort + "|" + value + "|" + strconv.FormatUint(tx.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// afterTransactionCursor restricts db to the transactions that come after
+// cursor in the given sort.
+func afterTransactionCursor(db *gorm.DB, cursor, sort, column string, desc bool) (*gorm.DB, error) {
+	invalid := errors.New("Invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort {
+		return nil, invalid
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	var value interface{}
+	if column == "created_at" {
+		t, err := time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			return nil, invalid
+		}
+		value = t
+	} else {
+		sen, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		value = sen
+	}
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return db.Where("("+column+" "+op+" ?) OR ("+column+" = ? AND id "+op+" ?)", value, value, id), nil
+}
+
+// sumTransactions computes the totals of every transaction matched by db.
+func sumTransactions(db *gorm.DB) (transactionTotals, error) {
+	var t transactionTotals
+	err := db.Select(
+		"COALESCE(SUM(CASE WHEN jenis = ? THEN jumlah_sen ELSE 0 END), 0) AS income, "+
+			"COALESCE(SUM(CASE WHEN jenis = ? THEN jumlah_sen ELSE 0 END), 0) AS expense, "+
+			"COALESCE(SUM(CASE WHEN jenis = ? THEN jumlah_sen ELSE 0 END), 0) AS transfer, "+
+			"COUNT(*) AS count",
+		models.JenisPemasukan, models.JenisPengeluaran, models.JenisTransfer,
+	).Scan(&t).Error
+	t.Net = t.Income - t.Expense
+	return t, err
+}
@@ -5,9 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"autentikasi/database"
+	"autentikasi/middleware"
 	"autentikasi/models"
 	"autentikasi/utils"
 
@@ -55,31 +57,45 @@ func UpdateMe(c *fiber.Ctx) error {
 		return utils.Fail(c, fiber.StatusBadRequest, "Invalid JSON body")
 	}
 
-	// apply updates if provided
-	if body.Nama != "" {
+	// apply updates if provided, remembering which fields changed
+	changed := []string{}
+	if body.Nama != "" && body.Nama != user.Nama {
 		user.Nama = body.Nama
+		changed = append(changed, "nama")
 	}
-	if body.ImgURL != "" {
+	if body.ImgURL != "" && (user.ImgURL == nil || *user.ImgURL != body.ImgURL) {
 		user.ImgURL = &body.ImgURL
+		changed = append(changed, "img")
 	}
-	if body.Phone != "" {
+	if body.Phone != "" && (user.Phone == nil || *user.Phone != body.Phone) {
+		// changing the phone number re-targets friend requests, so it needs a PIN step-up
+		if !middleware.IsElevated(c) {
+			return utils.Fail(c, fiber.StatusForbidden, "Verifikasi PIN diperlukan untuk mengubah nomor telepon")
+		}
 		user.Phone = &body.Phone
+		changed = append(changed, "phone")
 	}
-	if body.Gender != "" {
+	if body.Gender != "" && (user.Gender == nil || *user.Gender != body.Gender) {
 		user.Gender = &body.Gender
+		changed = append(changed, "gender")
 	}
-	if body.Status != "" {
+	if body.Status != "" && (user.Status == nil || *user.Status != body.Status) {
 		user.Status = &body.Status
+		changed = append(changed, "status")
 	}
 	if body.Birthday != "" {
-		if t, err := time.Parse(time.RFC3339, body.Birthday); err == nil {
+		if t, err := time.Parse(time.RFC3339, body.Birthday); err == nil && (user.Birthday == nil || !user.Birthday.Equal(t)) {
 			user.Birthday = &t
+			changed = append(changed, "birthday")
 		}
 	}
 
 	if err := database.DB.Save(user).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to update profile")
 	}
+	if len(changed) > 0 {
+		recordEvent(c, user.ID, "profile_updated", "Profile updated: "+strings.Join(changed, ", "), fiber.Map{"fields": changed})
+	}
 
 	// reuse Me response to include balance
 	return Me(c)
@@ -116,6 +132,7 @@ func UploadAvatar(c *fiber.Ctx) error {
 	if err := database.DB.Save(user).Error; err != nil {
 		return utils.Fail(c, fiber.StatusInternalServerError, "Failed to save user avatar")
 	}
+	recordEvent(c, user.ID, "avatar_uploaded", "Profile picture changed", fiber.Map{"file": fname, "size": file.Size})
 
 	// Return full URL to client for immediate use
 	imgURL := c.BaseURL() + "/uploads/" + fname
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"autentikasi/config"
+	"autentikasi/database"
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+var (
+	errCodeInvalid  = errors.New("Kode verifikasi salah")
+	errCodeExpired  = errors.New("Kode verifikasi sudah kedaluwarsa")
+	errCodeExceeded = errors.New("Terlalu banyak percobaan, minta kode baru")
+)
+
+// issueVerificationCode replaces any pending code of purpose for userID and
+// returns the plaintext 6-digit code and link token to send to email.
+func issueVerificationCode(userID uint64, purpose, email string, ttl time.Duration) (code, token string, err error) {
+	code, err = utils.GenerateOTP()
+	if err != nil {
+		return "", "", err
+	}
+	token, err = utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	database.DB.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+		Delete(&models.VerificationCode{})
+
+	vc := models.VerificationCode{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		CodeHash:  utils.HashCode(code),
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := database.DB.Create(&vc).Error; err != nil {
+		return "", "", err
+	}
+	return code, token, nil
+}
+
+// lastVerificationSent returns when the latest code of purpose was issued
+// for userID, used to enforce a resend cooldown.
+func lastVerificationSent(userID uint64, purpose string) *time.Time {
+	var vc models.VerificationCode
+	if err := database.DB.Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("id desc").First(&vc).Error; err != nil {
+		return nil
+	}
+	return vc.CreatedAt
+}
+
+// consumeVerificationCode checks a link token, or a code for the given
+// email or user, and marks the matching record consumed. Each code guess
+// uses one of the record's OTPMaxAttempts; the record is dropped once they
+// are used up.
+func consumeVerificationCode(purpose string, userID uint64, email, code, token string) (*models.VerificationCode, error) {
+	var vc models.VerificationCode
+	q := database.DB.Where("purpose = ? AND consumed_at IS NULL", purpose)
+	switch {
+	case token != "":
+		q = q.Where("token_hash = ?", utils.HashToken(token))
+	case userID != 0:
+		q = q.Where("user_id = ?", userID)
+	case email != "":
+		q = q.Where("email = ?", email)
+	default:
+		return nil, errCodeInvalid
+	}
+	if err := q.Order("id desc").First(&vc).Error; err != nil {
+		return nil, errCodeInvalid
+	}
+	if time.Now().After(vc.ExpiresAt) {
+		return nil, errCodeExpired
+	}
+
+	if token == "" {
+		// Reserve an attempt before comparing, like reset OTPs, so a burst
+		// of parallel guesses gets no more than OTPMaxAttempts compares.
+		maxAttempts := config.Load().OTPMaxAttempts
+		res := database.DB.Model(&models.VerificationCode{}).
+			Where("id = ? AND consumed_at IS NULL AND attempts < ?", vc.ID, maxAttempts).
+			UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		if res.Error != nil {
+			return nil, errCodeInvalid
+		}
+		if res.RowsAffected == 0 {
+			database.DB.Where("id = ? AND consumed_at IS NULL", vc.ID).Delete(&models.VerificationCode{})
+			return nil, errCodeExceeded
+		}
+		if !utils.CheckCode(code, vc.CodeHash) {
+			// Left for the next guess to delete; a parallel guess may be right.
+			if err := database.DB.Select("attempts").Take(&vc, vc.ID).Error; err == nil && vc.Attempts >= maxAttempts {
+				return nil, errCodeExceeded
+			}
+			return nil, errCodeInvalid
+		}
+	}
+
+	res := database.DB.Model(&models.VerificationCode{}).
+		Where("id = ? AND consumed_at IS NULL", vc.ID).
+		Update("consumed_at", time.Now())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, errCodeInvalid
+	}
+	return &vc, nil
+}
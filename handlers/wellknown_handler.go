@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/utils"
+)
+
+// JWKS - public keys that verify our tokens (standard JWK Set, not wrapped)
+// GET /.well-known/jwks.json
+func JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(utils.JWKS())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"net/url"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -9,6 +10,7 @@ import (
 	"github.com/joho/godotenv"
 
 	"autentikasi/config"
+	"autentikasi/connectors"
 	"autentikasi/database"
 	"autentikasi/routes"
 	"autentikasi/utils"
@@ -19,11 +21,29 @@ func main() {
 
 	cfg := config.Load()
 
+	if err := utils.InitKeys(cfg); err != nil {
+		log.Fatalf("JWT keys error: %v", err)
+	}
+	if cfg.CodeHashKey == "" || cfg.CodeHashKey == config.DefaultJWTSecret || cfg.CodeHashKey == cfg.JWTSecret {
+		log.Fatal("CODE_HASH_KEY must be set to a random secret other than JWT_SECRET")
+	}
+
+	if u, err := url.Parse(cfg.AppBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatal("APP_BASE_URL must be set to the public URL of the service, e.g. https://auth.dompetku.id")
+	}
+
+	if err := connectors.Init(cfg); err != nil {
+		log.Fatalf("Connectors error: %v", err)
+	}
+
 	if err := database.Connect(cfg); err != nil {
 		log.Fatalf("DB connect error: %v", err)
 	}
 	log.Println("✅ Database connected")
 
+	// Remove accounts whose deletion grace period is over
+	database.StartPurgeJob(cfg.PurgeInterval)
+
 	// Optional dev seeding: set DEV_SEED=true in your environment to create
 	// a developer user (dev@example.com / password) and sample transactions.
 	if err := database.SeedDev(); err != nil {
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/models"
+	"autentikasi/utils"
+)
+
+// ElevatedTokenHeader carries the short-lived token returned by
+// POST /api/v1/auth/pin/verify.
+const ElevatedTokenHeader = "X-Elevated-Token"
+
+// RequireElevation must run after JWTProtected. It rejects the request unless
+// the user re-confirmed their PIN in the current session a moment ago.
+func RequireElevation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !IsElevated(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "PIN verification required", "data": nil, "success": false})
+		}
+		return c.Next()
+	}
+}
+
+// IsElevated reports whether the request carries a valid elevated token for
+// the authenticated user and session. Handlers use it when only some inputs
+// (e.g. a phone change or a large amount) are sensitive.
+func IsElevated(c *fiber.Ctx) bool {
+	tokenStr := c.Get(ElevatedTokenHeader)
+	if tokenStr == "" {
+		return false
+	}
+	user, ok := c.Locals("user").(*models.User)
+	if !ok || user == nil {
+		return false
+	}
+	session, ok := c.Locals("session").(*models.Session)
+	if !ok || session == nil {
+		return false
+	}
+
+	claims, err := utils.ParseJWT(tokenStr)
+	if err != nil || claims.Type != utils.TokenElevated {
+		return false
+	}
+	return claims.UserID() == user.ID && claims.SessionID == session.ID
+}
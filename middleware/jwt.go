@@ -1,46 +1,104 @@
 package middleware
 
 import (
-	"errors"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 
 	"autentikasi/config"
 	"autentikasi/database"
 	"autentikasi/models"
+	"autentikasi/utils"
 )
 
-func JWTProtected() fiber.Handler {
+// JWTProtected authenticates the request with a session access token or,
+// when scopes are listed, also with an API key ("dpk_" prefix) that was
+// granted every one of them. Routes without scopes never accept API keys.
+func JWTProtected(scopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		auth := c.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Missing token", "data": nil, "success": false})
 		}
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
+		if strings.HasPrefix(tokenStr, models.APIKeyPrefix) {
+			return apiKeyAuth(c, tokenStr, scopes)
+		}
 
-		cfg := config.Load()
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(cfg.JWTSecret), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := utils.ParseJWT(tokenStr, config.Load().JWTAudiences...)
+		if err != nil || claims.Type != utils.TokenAccess {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Invalid token", "data": nil, "success": false})
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Invalid claims", "data": nil, "success": false})
+		var revoked int64
+		database.DB.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked)
+		if revoked > 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Token revoked", "data": nil, "success": false})
 		}
 
 		var user models.User
-		if err := database.DB.Where("id = ?", claims["sub"]).First(&user).Error; err != nil {
+		if err := database.DB.First(&user, claims.UserID()).Error; err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "User not found", "data": nil, "success": false})
 		}
+		if !user.CanAuthenticate() {
+			return accountBlocked(c, &user)
+		}
+
+		// Access tokens are bound to a server-side session so Logout and
+		// refresh token reuse detection take effect before the token expires.
+		var session models.Session
+		if err := database.DB.Where("id = ? AND user_id = ?", claims.SessionID, user.ID).First(&session).Error; err != nil || !session.Active(time.Now()) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Session revoked", "data": nil, "success": false})
+		}
+		// Track activity for the device list, at most once a minute per session.
+		now := time.Now()
+		if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) > time.Minute {
+			database.DB.Model(&session).Update("last_seen_at", now)
+		}
+		c.Locals("session", &session)
+		c.Locals("claims", claims)
 		c.Locals("user", &user)
 		return c.Next()
 	}
 }
+
+func apiKeyAuth(c *fiber.Ctx, token string, scopes []string) error {
+	var key models.APIKey
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(token)).First(&key).Error; err != nil || !key.Active(time.Now()) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "Invalid API key", "data": nil, "success": false})
+	}
+	if len(scopes) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "API keys cannot access this endpoint", "data": nil, "success": false})
+	}
+	for _, scope := range scopes {
+		if !key.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "API key lacks scope " + scope, "data": nil, "success": false})
+		}
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, key.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"code": "401", "message": "User not found", "data": nil, "success": false})
+	}
+	if !user.CanAuthenticate() {
+		return accountBlocked(c, &user)
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		database.DB.Model(&key).Update("last_used_at", now)
+	}
+	c.Locals("api_key", &key)
+	c.Locals("user", &user)
+	return c.Next()
+}
+
+// accountBlocked rejects a request from a suspended or locked account.
+func accountBlocked(c *fiber.Ctx, user *models.User) error {
+	msg := "Account suspended"
+	if user.Locked() {
+		msg = "Account locked"
+	}
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": msg, "data": nil, "success": false})
+}
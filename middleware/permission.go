@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/database"
+	"autentikasi/models"
+)
+
+// RequirePermission must run after JWTProtected. It rejects the request
+// unless the user's roles grant every listed permission. API keys are never
+// accepted, even on routes whose JWTProtected lists scopes.
+func RequirePermission(perms ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(*models.User)
+		if !ok || user == nil || c.Locals("api_key") != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "Forbidden", "data": nil, "success": false})
+		}
+		granted, err := UserPermissions(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"code": "500", "message": "Failed to load permissions", "data": nil, "success": false})
+		}
+		for _, p := range perms {
+			if !granted[p] {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "Missing permission " + p, "data": nil, "success": false})
+			}
+		}
+		return c.Next()
+	}
+}
+
+// UserPermissions returns the set of permissions granted by the user's roles.
+func UserPermissions(userID uint64) (map[string]bool, error) {
+	var names []string
+	err := database.DB.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set, nil
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"autentikasi/config"
+	"autentikasi/models"
+)
+
+// RequireVerifiedEmail must run after JWTProtected. When REQUIRE_VERIFIED_EMAIL
+// is enabled it blocks users who have not confirmed their e-mail address yet.
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !config.Load().RequireVerifiedEmail {
+			return c.Next()
+		}
+		user, ok := c.Locals("user").(*models.User)
+		if !ok || user == nil || user.EmailVerifiedAt == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"code": "403", "message": "E-mail belum diverifikasi", "data": nil, "success": false})
+		}
+		return c.Next()
+	}
+}
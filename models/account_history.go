@@ -1,15 +1,26 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// AccountHistory is an event in the user's account history. Events caused
+// by a request record where it came from and who made it: ActorID is the
+// user themselves or an administrator, and nil for events the service
+// records on its own. Logins also store the SHA-256 of the device id (see
+// KnownDevice). Metadata holds event-specific details as a JSON object.
 type AccountHistory struct {
-	ID          uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
-	UserID      uint64     `gorm:"index;column:user_id" json:"user_id"`
-	Event       string     `gorm:"size:64;column:event" json:"event"`
-	Description string     `gorm:"size:255;column:description" json:"description"`
-	CreatedAt   *time.Time `gorm:"column:created_at" json:"created_at"`
+	ID          uint64          `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID      uint64          `gorm:"index;column:user_id" json:"user_id"`
+	Event       string          `gorm:"size:64;column:event" json:"event"`
+	Description string          `gorm:"size:255;column:description" json:"description"`
+	IP          string          `gorm:"size:64;column:ip" json:"ip,omitempty"`
+	UserAgent   string          `gorm:"size:255;column:user_agent" json:"user_agent,omitempty"`
+	ActorID     *uint64         `gorm:"index;column:actor_id" json:"actor_id,omitempty"`
+	DeviceHash  string          `gorm:"size:64;column:device_hash" json:"-"`
+	Metadata    json.RawMessage `gorm:"type:json;column:metadata" json:"metadata,omitempty"`
+	CreatedAt   *time.Time      `gorm:"column:created_at" json:"created_at"`
 }
 
 func (AccountHistory) TableName() string { return "account_histories" }
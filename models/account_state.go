@@ -0,0 +1,59 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Account states. They say whether an account may be used and are separate
+// from Status, the display status the user edits on their profile.
+//
+//   - active: normal account
+//   - unverified: e-mail not verified yet; can log in, but some features
+//     need a verified address (REQUIRE_VERIFIED_EMAIL)
+//   - suspended: disabled by an administrator; no login, tokens and API
+//     keys stop working
+//   - locked: blocked for security (e.g. an administrator required a
+//     password reset); resetting the password unlocks it
+//   - pending_deletion: the user asked to delete the account; they can
+//     still log in to cancel until the purge job removes it
+const (
+	AccountActive          = "active"
+	AccountUnverified      = "unverified"
+	AccountSuspended       = "suspended"
+	AccountLocked          = "locked"
+	AccountPendingDeletion = "pending_deletion"
+)
+
+// AccountStates lists every valid state.
+var AccountStates = []string{AccountActive, AccountUnverified, AccountSuspended, AccountLocked, AccountPendingDeletion}
+
+// accountTransitions lists the states each state may move to.
+var accountTransitions = map[string][]string{
+	AccountActive:          {AccountUnverified, AccountSuspended, AccountLocked, AccountPendingDeletion},
+	AccountUnverified:      {AccountActive, AccountSuspended, AccountLocked, AccountPendingDeletion},
+	AccountSuspended:       {AccountActive, AccountUnverified, AccountLocked},
+	AccountLocked:          {AccountActive, AccountUnverified, AccountSuspended},
+	AccountPendingDeletion: {AccountActive, AccountUnverified, AccountSuspended, AccountLocked},
+}
+
+// CanTransition reports whether an account may move from one state to another.
+func CanTransition(from, to string) bool {
+	for _, s := range accountTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidAccountState reports whether s is a known state.
+func ValidAccountState(s string) bool {
+	_, ok := accountTransitions[s]
+	return ok
+}
+
+// Discoverable limits a user query to accounts other users may find and
+// befriend: suspended, locked and soon-deleted accounts are hidden.
+func Discoverable(db *gorm.DB) *gorm.DB {
+	return db.Where("account_state IN ?", []string{AccountActive, AccountUnverified})
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// AdminAudit records every request made through the admin API.
+type AdminAudit struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	AdminID      uint64     `gorm:"index;not null;column:admin_id" json:"admin_id"`
+	Action       string     `gorm:"size:64;not null;column:action" json:"action"`
+	TargetUserID *uint64    `gorm:"index;column:target_user_id" json:"target_user_id,omitempty"`
+	Details      string     `gorm:"size:255;column:details" json:"details,omitempty"`
+	IP           string     `gorm:"size:64;column:ip" json:"ip"`
+	CreatedAt    *time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (AdminAudit) TableName() string { return "admin_audits" }
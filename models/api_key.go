@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than JWTs.
+const APIKeyPrefix = "dpk_"
+
+// Scopes an API key can be granted.
+const (
+	ScopeProfileRead       = "profile:read"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeFriendsRead       = "friends:read"
+	ScopeFriendsWrite      = "friends:write"
+)
+
+// AllScopes lists every scope accepted when creating an API key.
+var AllScopes = []string{
+	ScopeProfileRead,
+	ScopeTransactionsRead,
+	ScopeTransactionsWrite,
+	ScopeFriendsRead,
+	ScopeFriendsWrite,
+}
+
+// APIKey is a personal access token for scripts and integrations. Only the
+// SHA-256 digest is stored; Prefix keeps the first characters so users can
+// tell their keys apart.
+type APIKey struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID     uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	Name       string     `gorm:"size:100;not null;column:name" json:"name"`
+	Prefix     string     `gorm:"size:16;not null;column:prefix" json:"prefix"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex;column:token_hash" json:"-"`
+	Scopes     string     `gorm:"size:255;not null;column:scopes" json:"-"` // space separated
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (APIKey) TableName() string { return "api_keys" }
+
+// ScopeList returns the granted scopes.
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope reports whether scope was granted to the key.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can be used at time now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// AuthThrottle counts failed authentication attempts for one key, such as
+// "login:account:<email>" or "login:ip:<addr>". Once Failures reaches the
+// key's limit every further failure locks the key for an exponentially
+// growing period.
+type AuthThrottle struct {
+	ID            uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	Key           string     `gorm:"size:191;not null;uniqueIndex;column:key" json:"key"`
+	UserID        uint64     `gorm:"index;column:user_id" json:"user_id"`
+	Failures      int        `gorm:"not null;default:0;column:failures" json:"failures"`
+	LockedUntil   *time.Time `gorm:"column:locked_until" json:"locked_until,omitempty"`
+	LastFailureAt *time.Time `gorm:"column:last_failure_at" json:"last_failure_at,omitempty"`
+	CreatedAt     *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt     *time.Time `gorm:"column:updated_at" json:"updated_at,omitempty"`
+}
+
+func (AuthThrottle) TableName() string { return "auth_throttles" }
+
+// EmailThrottleScopes are the scopes whose per-account keys hold the e-mail
+// address instead of the user ID, because they are counted before the
+// account is known.
+var EmailThrottleScopes = []string{"login", "otp", "magic"}
+
+// AccountThrottleKey is the key of the per-account counter of scope.
+func AccountThrottleKey(scope, account string) string {
+	return scope + ":account:" + account
+}
+
+// EmailThrottleKeys returns every per-account key that can hold failures
+// counted against email.
+func EmailThrottleKeys(email string) []string {
+	keys := make([]string, 0, len(EmailThrottleScopes))
+	for _, scope := range EmailThrottleScopes {
+		keys = append(keys, AccountThrottleKey(scope, email))
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// ExternalIdentity links a user to an account at an upstream identity
+// provider (see package connectors). Subject is the provider's stable user id.
+type ExternalIdentity struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID      uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	Connector   string     `gorm:"size:64;not null;uniqueIndex:idx_connector_subject;column:connector" json:"connector"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_connector_subject;column:subject" json:"-"`
+	Email       string     `gorm:"size:100;column:email" json:"email"`
+	LastLoginAt *time.Time `gorm:"column:last_login_at" json:"last_login_at,omitempty"`
+	CreatedAt   *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (ExternalIdentity) TableName() string { return "external_identities" }
+
+// ConnectorState carries one upstream login from start to callback: the
+// state sent upstream (stored hashed), the nonce expected in the ID token and
+// the PKCE verifier. UserID is set when an existing user links an identity.
+type ConnectorState struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	StateHash    string     `gorm:"size:64;not null;uniqueIndex;column:state_hash" json:"-"`
+	Connector    string     `gorm:"size:64;not null;column:connector" json:"connector"`
+	Purpose      string     `gorm:"size:16;not null;column:purpose" json:"purpose"`
+	UserID       uint64     `gorm:"column:user_id" json:"user_id"`
+	Nonce        string     `gorm:"size:64;column:nonce" json:"-"`
+	CodeVerifier string     `gorm:"size:128;column:code_verifier" json:"-"`
+	ClientID     string     `gorm:"size:64;column:client_id" json:"client_id"`
+	DeviceName   string     `gorm:"size:100;column:device_name" json:"device_name"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	ConsumedAt   *time.Time `gorm:"column:consumed_at" json:"consumed_at,omitempty"`
+	CreatedAt    *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (ConnectorState) TableName() string { return "connector_states" }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// KnownDevice is a device the user has logged in from. Devices identify
+// themselves with a random id kept in a cookie or sent as X-Device-ID; only
+// its SHA-256 digest is stored.
+type KnownDevice struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID      uint64     `gorm:"not null;uniqueIndex:idx_known_device;column:user_id" json:"user_id"`
+	DeviceHash  string     `gorm:"size:64;not null;uniqueIndex:idx_known_device;column:device_hash" json:"-"`
+	UserAgent   string     `gorm:"size:255;column:user_agent" json:"user_agent"`
+	IP          string     `gorm:"size:64;column:ip" json:"ip"`
+	FirstSeenAt time.Time  `gorm:"column:first_seen_at" json:"first_seen_at"`
+	LastSeenAt  *time.Time `gorm:"column:last_seen_at" json:"last_seen_at,omitempty"`
+}
+
+func (KnownDevice) TableName() string { return "known_devices" }
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of rupiah counted in sen (1/100 rupiah). It is stored
+// as a BIGINT and summed by the database exactly; it never goes through a
+// float.
+//
+// In JSON it is a number with two decimals (12500.50). Input may be a
+// number or a string holding one, and is rounded to the sen, half away from
+// zero:
+//
+//	"12500"   -> 12500.00
+//	"0.125"   -> 0.13
+//	"-0.125"  -> -0.13
+//	"0.1249"  -> 0.12
+//	"1.5e3"   -> 1500.00
+type Money int64
+
+// MoneyScale is the number of sen in a rupiah.
+const MoneyScale = 100
+
+var (
+	errMoneyFormat = errors.New("invalid amount")
+	errMoneyRange  = errors.New("amount out of range")
+
+	// The JSON number grammar; big.Rat alone would also take fractions
+	// ("1/3") and hexadecimal.
+	moneyPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]{1,3})?$`)
+)
+
+// Rupiah returns n whole rupiah.
+func Rupiah(n int64) Money { return Money(n * MoneyScale) }
+
+// ParseMoney reads a decimal amount of rupiah, rounding it to the sen half
+// away from zero. The decimal is read exactly, so 1.005 rounds to 1.01.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 64 || !moneyPattern.MatchString(s) {
+		return 0, errMoneyFormat
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, errMoneyFormat
+	}
+	r.Mul(r, big.NewRat(MoneyScale, 1))
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// QuoRem truncates towards zero; a remainder of at least half the
+	// denominator moves the result one sen further from zero.
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, errMoneyRange
+	}
+	return Money(q.Int64()), nil
+}
+
+// MoneyFromFloat converts a float amount of rupiah, as amounts were kept
+// before Money. It takes the shortest decimal that reads back as f, the way
+// the value was shown to users, and rounds that with ParseMoney; so 1.005,
+// stored as 1.00499999999999989..., still becomes 1.01.
+func MoneyFromFloat(f float64) (Money, error) {
+	return ParseMoney(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// String formats m in rupiah with two decimals, e.g. "-12500.50".
+func (m Money) String() string {
+	sign := ""
+	v := uint64(m)
+	if m < 0 {
+		sign = "-"
+		v = uint64(-m) // also right for the smallest int64
+	}
+	return sign + strconv.FormatUint(v/MoneyScale, 10) + "." + strconv.FormatUint(v%MoneyScale/10, 10) + strconv.FormatUint(v%10, 10)
+}
+
+// MarshalJSON writes m as a JSON number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a string holding one. null leaves m
+// unchanged, like for the built-in types.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return errMoneyFormat
+		}
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// UnmarshalText reads form and query values.
+func (m *Money) UnmarshalText(b []byte) error {
+	v, err := ParseMoney(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
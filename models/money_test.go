@@ -0,0 +1,197 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// The rounding rules of amounts: decimals are read exactly and rounded to
+// the sen, half away from zero.
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"0", 0},
+		{"12500", 1250000},
+		{"12500.5", 1250050},
+		{"12500.50", 1250050},
+		{" 7.25 ", 725},
+
+		// Half away from zero.
+		{"0.125", 13},
+		{"0.135", 14},
+		{"0.005", 1},
+		{"2.675", 268}, // 2.67499999... as a float64, but exactly 2.675 here
+		{"1.005", 101},
+
+		// Below half rounds towards zero, above half away from it.
+		{"0.1249", 12},
+		{"0.12499999999999999999", 12},
+		{"0.1251", 13},
+		{"0.004", 0},
+		{"0.0049999", 0},
+
+		// Negative values mirror positive ones.
+		{"-0.125", -13},
+		{"-0.1249", -12},
+		{"-0.005", -1},
+		{"-0.004", 0},
+		{"-12500.50", -1250050},
+
+		// Exponents.
+		{"1.5e3", 150000},
+		{"1E2", 10000},
+		{"125e-3", 13},
+		{"-5e-3", -1},
+
+		// The limits of int64 sen.
+		{"92233720368547758.07", math.MaxInt64},
+		{"-92233720368547758.08", math.MinInt64},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"", errMoneyFormat},
+		{"abc", errMoneyFormat},
+		{"1,5", errMoneyFormat},
+		{"1.", errMoneyFormat},
+		{".5", errMoneyFormat},
+		{"+1", errMoneyFormat},
+		{"01", errMoneyFormat},
+		{"1/3", errMoneyFormat},
+		{"0x10", errMoneyFormat},
+		{"NaN", errMoneyFormat},
+		{"Inf", errMoneyFormat},
+		{"1e1000", errMoneyFormat}, // exponents have at most 3 digits
+		{"92233720368547758.08", errMoneyRange},
+		{"-92233720368547758.09", errMoneyRange},
+		{"1e999", errMoneyRange},
+	}
+	for _, tt := range tests {
+		if got, err := ParseMoney(tt.in); err != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v; want error %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// MoneyFromFloat is how amounts stored as DOUBLE are migrated: the shortest
+// decimal that reads back as the same float, then the rules above.
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{0, 0},
+		{4500000, 450000000},
+		{0.1 + 0.2, 30}, // 0.30000000000000004
+		{1.1 * 3, 330},  // 3.3000000000000003
+		{1.005, 101},    // stored as 1.00499999999999989...
+		{2.675, 268},    // stored as 2.67499999999999982...
+		{12.345, 1235},
+		{0.125, 13},
+		{-0.125, -13},
+		{-20000.5, -2000050},
+		{math.Copysign(0, -1), 0},
+		{1e15, 100000000000000000},
+	}
+	for _, tt := range tests {
+		got, err := MoneyFromFloat(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, f := range []float64{1e17, 1e21, math.Inf(1), math.NaN()} {
+		if got, err := MoneyFromFloat(f); err == nil {
+			t.Errorf("MoneyFromFloat(%v) = %d, want an error", f, got)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1250050, "12500.50"},
+		{-1250050, "-12500.50"},
+		{Rupiah(4500000), "4500000.00"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+		// Every amount survives a trip through its own text.
+		if back, err := ParseMoney(tt.in.String()); err != nil || back != tt.in {
+			t.Errorf("ParseMoney(%q) = %d, %v", tt.in.String(), back, err)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(struct {
+		Jumlah Money  `json:"jumlah"`
+		Saldo  *Money `json:"saldo"`
+	}{Jumlah: 1250050})
+	if err != nil || string(b) != `{"jumlah":12500.50,"saldo":null}` {
+		t.Fatalf("Marshal = %s, %v", b, err)
+	}
+
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`{"jumlah": 12500.5}`, 1250050},
+		{`{"jumlah": "12500.50"}`, 1250050},
+		{`{"jumlah": 0.125}`, 13},
+		{`{"jumlah": 1.25e4}`, 1250000},
+		{`{"jumlah": -7}`, -700},
+		{`{"jumlah": null}`, 99}, // null leaves the value alone
+		{`{}`, 99},
+	}
+	for _, tt := range tests {
+		v := struct {
+			Jumlah Money `json:"jumlah"`
+		}{Jumlah: 99}
+		if err := json.Unmarshal([]byte(tt.in), &v); err != nil || v.Jumlah != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d", tt.in, v.Jumlah, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{`{"jumlah": true}`, `{"jumlah": "abc"}`, `{"jumlah": [1]}`, `{"jumlah": 1e30}`, `{"jumlah": "1/3"}`} {
+		var v struct {
+			Jumlah Money `json:"jumlah"`
+		}
+		if err := json.Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("Unmarshal(%s) = %d, want an error", in, v.Jumlah)
+		}
+	}
+
+	var patch struct {
+		Jumlah *Money `json:"jumlah"`
+	}
+	if err := json.Unmarshal([]byte(`{"jumlah": "0.5"}`), &patch); err != nil || patch.Jumlah == nil || *patch.Jumlah != 50 {
+		t.Errorf("Unmarshal into *Money = %v, %v", patch.Jumlah, err)
+	}
+
+	var m Money
+	if err := m.UnmarshalText([]byte("2.675")); err != nil || m != 268 {
+		t.Errorf("UnmarshalText = %d, %v", m, err)
+	}
+}
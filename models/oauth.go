@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OpenID Connect scopes a client may request.
+const (
+	OIDCScopeOpenID        = "openid"
+	OIDCScopeProfile       = "profile"
+	OIDCScopeEmail         = "email"
+	OIDCScopePhone         = "phone"
+	OIDCScopeOfflineAccess = "offline_access"
+)
+
+var OIDCScopes = []string{OIDCScopeOpenID, OIDCScopeProfile, OIDCScopeEmail, OIDCScopePhone, OIDCScopeOfflineAccess}
+
+// OAuthClient is an application that can "Sign in with Dompetku". Public
+// clients (mobile apps, SPAs) have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ClientID     string     `gorm:"size:64;not null;uniqueIndex;column:client_id" json:"client_id"`
+	Name         string     `gorm:"size:100;not null;column:name" json:"name"`
+	SecretHash   string     `gorm:"size:64;column:secret_hash" json:"-"`
+	RedirectURIs string     `gorm:"type:text;column:redirect_uris" json:"-"` // space separated
+	CreatedBy    uint64     `gorm:"column:created_by" json:"created_by"`
+	RevokedAt    *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt    *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (OAuthClient) TableName() string { return "oauth_clients" }
+
+// Public reports whether the client authenticates without a secret.
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect URI.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	for _, u := range c.RedirectURIList() {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthAuthorization is one run of the authorization code flow. It is created
+// by /oauth/authorize, gets a UserID and a code when the user approves the
+// consent screen, and is consumed by /oauth/token.
+type OAuthAuthorization struct {
+	ID            uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	RequestID     string     `gorm:"size:64;not null;uniqueIndex;column:request_id" json:"request_id"`
+	ClientID      string     `gorm:"size:64;not null;index;column:client_id" json:"client_id"`
+	RedirectURI   string     `gorm:"size:255;not null;column:redirect_uri" json:"redirect_uri"`
+	Scope         string     `gorm:"size:255;column:scope" json:"scope"`
+	State         string     `gorm:"size:255;column:state" json:"-"`
+	Nonce         string     `gorm:"size:255;column:nonce" json:"-"`
+	CodeChallenge string     `gorm:"size:128;column:code_challenge" json:"-"`
+	UserID        uint64     `gorm:"index;column:user_id" json:"user_id,omitempty"`
+	CodeHash      *string    `gorm:"size:64;uniqueIndex;column:code_hash" json:"-"`
+	SessionID     uint64     `gorm:"column:session_id" json:"-"`
+	ExpiresAt     time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	ConsumedAt    *time.Time `gorm:"column:consumed_at" json:"-"`
+	CreatedAt     *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (OAuthAuthorization) TableName() string { return "oauth_authorizations" }
+
+// OAuthConsent remembers the scopes a user approved for a client so the
+// consent screen can be skipped next time.
+type OAuthConsent struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID    uint64     `gorm:"not null;uniqueIndex:idx_oauth_consent;column:user_id" json:"user_id"`
+	ClientID  string     `gorm:"size:64;not null;uniqueIndex:idx_oauth_consent;column:client_id" json:"client_id"`
+	Scope     string     `gorm:"size:255;column:scope" json:"scope"`
+	CreatedAt *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt *time.Time `gorm:"column:updated_at" json:"updated_at,omitempty"`
+}
+
+func (OAuthConsent) TableName() string { return "oauth_consents" }
+
+// Covers reports whether every scope in scope was already approved.
+func (c *OAuthConsent) Covers(scope string) bool {
+	granted := strings.Fields(c.Scope)
+	for _, s := range strings.Fields(scope) {
+		found := false
+		for _, g := range granted {
+			if g == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
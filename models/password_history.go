@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory keeps the bcrypt hashes of a user's recent passwords so
+// they cannot be reused. Only the newest PASSWORD_HISTORY rows are kept.
+type PasswordHistory struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID    uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	Hash      string     `gorm:"size:255;not null;column:hash" json:"-"`
+	CreatedAt *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (PasswordHistory) TableName() string { return "password_histories" }
@@ -6,14 +6,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// PasswordReset tracks one forgot-password attempt. The OTP is stored only
+// as a hash; once it is verified it is exchanged for a single-use reset token
+// (also stored as a hash) that ResetPassword consumes.
 type PasswordReset struct {
-	ID        uint64         `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
-	Email     string         `gorm:"size:100;not null;index;column:email" json:"email"`
-	OTP       string         `gorm:"size:10;not null;column:otp" json:"otp"`
-	ExpiresAt time.Time      `gorm:"column:expires_at;index" json:"expires_at"`
-	CreatedAt *time.Time     `gorm:"column:created_at" json:"created_at,omitempty"`
-	UpdatedAt *time.Time     `gorm:"column:updated_at" json:"updated_at,omitempty"`
-	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`
+	ID                  uint64         `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	Email               string         `gorm:"size:100;not null;index;column:email" json:"email"`
+	OTPHash             string         `gorm:"size:255;not null;column:otp_hash" json:"-"`
+	Attempts            int            `gorm:"not null;default:0;column:attempts" json:"-"` // guesses so far, each reserved before it is compared
+	ExpiresAt           time.Time      `gorm:"column:expires_at;index" json:"expires_at"`
+	VerifiedAt          *time.Time     `gorm:"column:verified_at" json:"verified_at,omitempty"`
+	ResetTokenHash      *string        `gorm:"size:64;uniqueIndex;column:reset_token_hash" json:"-"`
+	ResetTokenExpiresAt *time.Time     `gorm:"column:reset_token_expires_at" json:"-"`
+	CreatedAt           *time.Time     `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt           *time.Time     `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt           gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`
 }
 
 func (PasswordReset) TableName() string { return "password_resets" }
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time code that can replace a TOTP code when the
+// user lost their authenticator. Only the SHA-256 digest is stored.
+type RecoveryCode struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID    uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null;column:code_hash" json:"-"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	CreatedAt *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (RecoveryCode) TableName() string { return "recovery_codes" }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a single-use refresh token. Only the SHA-256 digest of the
+// token is stored; UsedAt is set when the token is rotated so a second use can
+// be detected as reuse.
+type RefreshToken struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	SessionID uint64     `gorm:"not null;index;column:session_id" json:"session_id"`
+	UserID    uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex;column:token_hash" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	CreatedAt *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (RefreshToken) TableName() string { return "refresh_tokens" }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken denylists a single JWT by its jti until the token would have
+// expired anyway, after which the row can be pruned.
+type RevokedToken struct {
+	ID        uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	JTI       string     `gorm:"size:64;not null;uniqueIndex;column:jti" json:"jti"`
+	UserID    uint64     `gorm:"index;column:user_id" json:"user_id"`
+	Reason    string     `gorm:"size:64;column:reason" json:"reason"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	CreatedAt *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (RevokedToken) TableName() string { return "revoked_tokens" }
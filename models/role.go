@@ -0,0 +1,39 @@
+package models
+
+// Permissions checked by middleware.RequirePermission.
+const (
+	PermUsersRead     = "users:read"     // search and view accounts
+	PermUsersManage   = "users:manage"   // disable/enable, force password reset
+	PermUsersUnlock   = "users:unlock"   // clear login and PIN lockouts
+	PermHistoryRead   = "history:read"   // view another user's account history
+	PermRolesManage   = "roles:manage"   // assign roles
+	PermAuditRead     = "audit:read"     // view the admin audit log
+	PermClientsManage = "clients:manage" // register OAuth clients
+)
+
+// Built-in roles, created at startup.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// DefaultRoles lists the permissions of each built-in role.
+var DefaultRoles = map[string][]string{
+	RoleAdmin:   {PermUsersRead, PermUsersManage, PermUsersUnlock, PermHistoryRead, PermRolesManage, PermAuditRead, PermClientsManage},
+	RoleSupport: {PermUsersRead, PermUsersUnlock, PermHistoryRead},
+}
+
+type Permission struct {
+	ID   uint64 `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	Name string `gorm:"size:64;not null;uniqueIndex;column:name" json:"name"`
+}
+
+func (Permission) TableName() string { return "permissions" }
+
+type Role struct {
+	ID          uint64       `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	Name        string       `gorm:"size:64;not null;uniqueIndex;column:name" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+}
+
+func (Role) TableName() string { return "roles" }
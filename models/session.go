@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a server-side login. Every refresh token issued for a login
+// belongs to the same session, so revoking the session kills the whole
+// refresh token family and every access token that carries its id.
+type Session struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID       uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	ClientID     string     `gorm:"size:64;column:client_id" json:"client_id"`    // aud of the access tokens
+	Scope        string     `gorm:"size:255;column:scope" json:"scope,omitempty"` // set for OAuth client sessions only
+	DeviceName   string     `gorm:"size:100;column:device_name" json:"device_name"`
+	UserAgent    string     `gorm:"size:255;column:user_agent" json:"user_agent"`
+	IP           string     `gorm:"size:64;column:ip" json:"ip"`
+	LastSeenAt   *time.Time `gorm:"column:last_seen_at" json:"last_seen_at,omitempty"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	RevokedAt    *time.Time `gorm:"column:revoked_at;index" json:"revoked_at,omitempty"`
+	RevokeReason string     `gorm:"size:64;column:revoke_reason" json:"revoke_reason,omitempty"`
+	CreatedAt    *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt    *time.Time `gorm:"column:updated_at" json:"updated_at,omitempty"`
+}
+
+func (Session) TableName() string { return "sessions" }
+
+// Active reports whether the session can still be used at time now.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
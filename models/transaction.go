@@ -6,14 +6,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// Kinds of transaction (Jenis). Transfers move money between the user's own
+// accounts and do not change the balance.
+const (
+	JenisPemasukan   = "pemasukan"
+	JenisPengeluaran = "pengeluaran"
+	JenisTransfer    = "transfer"
+)
+
+// TransactionKinds lists every valid Jenis.
+var TransactionKinds = []string{JenisPemasukan, JenisPengeluaran, JenisTransfer}
+
 type Transaction struct {
 	ID         uint64         `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
-	UserID     uint64         `gorm:"not null;column:user_id" json:"user_id"`
-	Jenis      string         `gorm:"size:50;not null;column:jenis" json:"jenis"` // contoh: salary, grocery
-	Jumlah     float64        `gorm:"column:jumlah;not null" json:"jumlah"`
+	UserID     uint64         `gorm:"not null;column:user_id;index:idx_transactions_user_created,priority:1" json:"user_id"`
+	Jenis      string         `gorm:"size:50;not null;column:jenis" json:"jenis"` // pemasukan, pengeluaran, transfer
+	Jumlah     Money          `gorm:"column:jumlah_sen;not null" json:"jumlah"`
 	Metode     string         `gorm:"size:100;column:metode" json:"metode"`
-	Keterangan string         `gorm:"size:255;column:keterangan" json:"keterangan"`
-	CreatedAt  *time.Time     `gorm:"column:created_at" json:"created_at,omitempty"`
+	Kategori   string         `gorm:"size:50;column:kategori;index" json:"kategori"`
+	Keterangan string         `gorm:"size:255;column:keterangan;index:idx_transactions_keterangan,class:FULLTEXT" json:"keterangan"`
+	CreatedAt  *time.Time     `gorm:"column:created_at;index:idx_transactions_user_created,priority:2" json:"created_at,omitempty"`
 	UpdatedAt  *time.Time     `gorm:"column:updated_at" json:"updated_at,omitempty"`
 	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`
 }
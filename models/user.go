@@ -21,6 +21,82 @@ type User struct {
 	CreatedAt   *time.Time     `gorm:"column:created_at" json:"created_at,omitempty"`
 	UpdatedAt   *time.Time     `gorm:"column:updated_at" json:"updated_at,omitempty"`
 	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`
+
+	// Two-factor authentication (TOTP). The secret is set during enrollment
+	// and only enforced once TOTPEnabledAt is set by a confirmation code.
+	TOTPSecret    *string    `gorm:"size:64;column:totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+
+	// Wrong PIN guesses since the last success; reaching the limit sets PinLockedUntil.
+	PinFailedAttempts int        `gorm:"column:pin_failed_attempts;not null;default:0" json:"-"`
+	PinLockedUntil    *time.Time `gorm:"column:pin_locked_until" json:"-"`
+
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"email_verified_at,omitempty"`
+
+	// Account state machine (see account_state.go). StateReason and
+	// StateChangedAt describe the last transition.
+	AccountState   string     `gorm:"size:32;not null;default:active;index;column:account_state" json:"-"`
+	StateReason    string     `gorm:"size:255;column:state_reason" json:"-"`
+	StateChangedAt *time.Time `gorm:"column:state_changed_at" json:"-"`
+
+	Roles []Role `gorm:"many2many:user_roles" json:"-"`
+
+	// Set while the user has at least one registered passkey; a passkey
+	// counts as a second factor just like TOTP.
+	HasPasskeys bool `gorm:"column:has_passkeys;not null;default:false" json:"-"`
+
+	// When the purge job removes an account in the pending_deletion state.
+	DeletionScheduledAt *time.Time `gorm:"column:deletion_scheduled_at;index" json:"-"`
+}
+
+// MFAEnabled reports whether login requires a second factor.
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabled() || u.HasPasskeys
+}
+
+// TOTPEnabled reports whether an authenticator app is enrolled.
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Suspended reports whether an admin has suspended the account.
+func (u *User) Suspended() bool {
+	return u.AccountState == AccountSuspended
+}
+
+// Locked reports whether the account is locked for security.
+func (u *User) Locked() bool {
+	return u.AccountState == AccountLocked
+}
+
+// PendingDeletion reports whether the account is scheduled for deletion.
+func (u *User) PendingDeletion() bool {
+	return u.AccountState == AccountPendingDeletion
+}
+
+// DueForPurge reports whether the purge job may remove the account: it is
+// pending deletion, or was soft-deleted, and its deletion date has passed.
+func (u *User) DueForPurge(now time.Time) bool {
+	if u.DeletionScheduledAt == nil || u.DeletionScheduledAt.After(now) {
+		return false
+	}
+	return u.DeletedAt.Valid || u.PendingDeletion()
+}
+
+// CanAuthenticate reports whether the account's tokens and API keys may be
+// used at all.
+func (u *User) CanAuthenticate() bool {
+	return !u.Suspended() && !u.Locked()
+}
+
+// UsableState is the state an account returns to when a suspension, lock
+// or deletion request is lifted.
+func (u *User) UsableState() string {
+	if u.EmailVerifiedAt == nil {
+		return AccountUnverified
+	}
+	return AccountActive
 }
 
 func (User) TableName() string { return "users" }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Purposes of a VerificationCode.
+const (
+	PurposeEmailVerify = "email_verify"
+	PurposeEmailChange = "email_change"
+	PurposeMagicLogin  = "magic_login"
+	PurposeLoginAlert  = "login_alert" // "this wasn't me" link; token only
+)
+
+// VerificationCode is a short-lived secret sent by e-mail: a 6-digit code the
+// user types (stored as an HMAC, see utils.HashCode) and a link token (stored
+// as SHA-256).
+// Either one proves control of Email and consumes the record.
+type VerificationCode struct {
+	ID         uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID     uint64     `gorm:"not null;index;column:user_id" json:"user_id"`
+	Purpose    string     `gorm:"size:32;not null;index;column:purpose" json:"purpose"`
+	Email      string     `gorm:"size:100;not null;index;column:email" json:"email"`
+	CodeHash   string     `gorm:"size:255;not null;column:code_hash" json:"-"`
+	TokenHash  string     `gorm:"size:64;not null;index;column:token_hash" json:"-"`
+	Attempts   int        `gorm:"not null;default:0;column:attempts" json:"-"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	ConsumedAt *time.Time `gorm:"column:consumed_at" json:"consumed_at,omitempty"`
+	CreatedAt  *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (VerificationCode) TableName() string { return "verification_codes" }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Purposes of a WebAuthnChallenge.
+const (
+	WebAuthnRegister = "register"
+	WebAuthnLogin    = "login"
+	WebAuthnMFA      = "mfa"
+)
+
+// WebAuthnCredential is a passkey registered by a user. PublicKey is the
+// COSE key from the authenticator; SignCount is the last counter seen and is
+// used to spot cloned authenticators.
+type WebAuthnCredential struct {
+	ID           uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	UserID       uint64     `gorm:"not null;index;column:user_id" json:"-"`
+	Name         string     `gorm:"size:100;not null;column:name" json:"name"`
+	CredentialID string     `gorm:"size:255;not null;uniqueIndex;column:credential_id" json:"credential_id"` // base64url
+	PublicKey    []byte     `gorm:"type:blob;not null;column:public_key" json:"-"`
+	SignCount    uint32     `gorm:"not null;default:0;column:sign_count" json:"-"`
+	AAGUID       string     `gorm:"size:36;column:aaguid" json:"aaguid,omitempty"`
+	Transports   string     `gorm:"size:100;column:transports" json:"-"` // comma separated
+	LastUsedAt   *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	CreatedAt    *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (WebAuthnCredential) TableName() string { return "webauthn_credentials" }
+
+// WebAuthnChallenge is an outstanding registration or login ceremony. Only
+// the SHA-256 digest of the challenge is stored; it is consumed on first use.
+// UserID is 0 for a discoverable-credential login that did not name a user.
+type WebAuthnChallenge struct {
+	ID            uint64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ChallengeHash string     `gorm:"size:64;not null;uniqueIndex;column:challenge_hash" json:"-"`
+	Purpose       string     `gorm:"size:16;not null;column:purpose" json:"purpose"`
+	UserID        uint64     `gorm:"not null;default:0;index;column:user_id" json:"user_id"`
+	ExpiresAt     time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	ConsumedAt    *time.Time `gorm:"column:consumed_at" json:"consumed_at,omitempty"`
+	CreatedAt     *time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+}
+
+func (WebAuthnChallenge) TableName() string { return "webauthn_challenges" }
@@ -1,11 +1,15 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/gofiber/fiber/v2"
 
 	"autentikasi/config"
 	"autentikasi/handlers"
 	"autentikasi/middleware"
+	"autentikasi/models"
+	"autentikasi/utils"
 )
 
 func SetupRoutes(app *fiber.App, cfg *config.Config) {
@@ -18,37 +22,127 @@ func SetupRoutes(app *fiber.App, cfg *config.Config) {
 		return c.Next()
 	})
 
+	app.Get("/.well-known/jwks.json", handlers.JWKS)
+
 	api := app.Group("/api/v1")
 
+	// OpenID Connect provider. ID tokens must be verifiable with the JWKS,
+	// so the provider is only served with RS256 or EdDSA keys; an HS256
+	// token could only be checked by knowing JWT_SECRET.
+	if utils.SigningAlg() == "HS256" {
+		log.Println("[OIDC] provider endpoints disabled: set JWT_ALG=RS256 or EdDSA to enable them")
+	} else {
+		app.Get("/.well-known/openid-configuration", handlers.OIDCDiscovery)
+		oauth := app.Group("/oauth")
+		oauth.Get("/authorize", handlers.OAuthAuthorize)
+		oauth.Post("/token", handlers.OAuthToken)
+		oauth.Get("/userinfo", handlers.OAuthUserInfo)
+		oauth.Post("/userinfo", handlers.OAuthUserInfo)
+
+		// Consent screen
+		api.Get("/oauth/authorize/:request_id", middleware.JWTProtected(), handlers.OAuthConsentInfo)
+		api.Post("/oauth/authorize/:request_id", middleware.JWTProtected(), handlers.OAuthConsent)
+	}
+
 	auth := api.Group("/auth")
 	auth.Post("/register", handlers.Register)
 	auth.Post("/login", handlers.Login)
+	auth.Post("/refresh", handlers.Refresh)
+	auth.Post("/magic-link", handlers.RequestMagicLink)
+	auth.Post("/magic-link/verify", handlers.VerifyMagicLink)
+	auth.Get("/not-me", handlers.ConfirmReportLogin)
+	auth.Post("/not-me", handlers.ReportLogin)
 	auth.Post("/logout", middleware.JWTProtected(), handlers.Logout)
+	auth.Post("/tokens/revoke", middleware.JWTProtected(), handlers.RevokeToken)
 	auth.Post("/forgot-password", handlers.ForgotPassword)
 	auth.Post("/verify-otp", handlers.VerifyOTP)
 	auth.Post("/reset-password", handlers.ResetPassword)
+	auth.Get("/verify-email", handlers.VerifyEmail)
+	auth.Post("/verify-email", handlers.VerifyEmail)
+	auth.Post("/verify-email/resend", middleware.JWTProtected(), handlers.ResendVerificationEmail)
 	auth.Get("/history", middleware.JWTProtected(), handlers.GetAuthHistory)
+	auth.Post("/mfa/verify", handlers.VerifyMFA)
+	auth.Post("/mfa/passkey/begin", handlers.BeginPasskeyMFA)
+	auth.Post("/passkeys/login/begin", handlers.BeginPasskeyLogin)
+	auth.Post("/passkeys/login/finish", handlers.FinishPasskeyLogin)
+	auth.Post("/mfa/totp/setup", middleware.JWTProtected(), handlers.SetupTOTP)
+	auth.Post("/mfa/totp/confirm", middleware.JWTProtected(), handlers.ConfirmTOTP)
+	auth.Post("/mfa/totp/disable", middleware.JWTProtected(), handlers.DisableTOTP)
+	auth.Post("/mfa/recovery-codes", middleware.JWTProtected(), handlers.RegenerateRecoveryCodes)
+	auth.Post("/pin", middleware.JWTProtected(), handlers.SetPin)
+	auth.Put("/pin", middleware.JWTProtected(), handlers.ChangePin)
+	auth.Post("/pin/verify", middleware.JWTProtected(), handlers.VerifyPin)
+	auth.Get("/connectors", handlers.ListConnectors)
+	auth.Post("/connectors/:id/start", handlers.ConnectorStart)
+	auth.Post("/connectors/:id/callback", handlers.ConnectorCallback)
+	auth.Get("/sessions", middleware.JWTProtected(), handlers.ListSessions)
+	auth.Delete("/sessions", middleware.JWTProtected(), handlers.RevokeOtherSessions)
+	auth.Delete("/sessions/:id", middleware.JWTProtected(), handlers.RevokeSession)
 
-	api.Get("/me", middleware.JWTProtected(), handlers.Me)
+	api.Get("/me", middleware.JWTProtected(models.ScopeProfileRead), handlers.Me)
 	api.Get("/users/:id", middleware.JWTProtected(), handlers.GetUserProfile)
 	api.Put("/me", middleware.JWTProtected(), handlers.UpdateMe)
+	api.Delete("/me", middleware.JWTProtected(), handlers.DeleteAccount)
+	api.Post("/me/deletion/cancel", middleware.JWTProtected(), handlers.CancelAccountDeletion)
+	api.Get("/me/export", middleware.JWTProtected(), handlers.ExportData)
 	api.Post("/me/avatar", middleware.JWTProtected(), handlers.UploadAvatar)
+	api.Post("/me/password", middleware.JWTProtected(), handlers.ChangePassword)
+	api.Post("/me/email", middleware.JWTProtected(), middleware.RequireElevation(), handlers.RequestEmailChange)
+	api.Post("/me/email/confirm", middleware.JWTProtected(), handlers.ConfirmEmailChange)
+	api.Get("/me/tokens", middleware.JWTProtected(), handlers.ListAPIKeys)
+	api.Post("/me/tokens", middleware.JWTProtected(), handlers.CreateAPIKey)
+	api.Delete("/me/tokens/:id", middleware.JWTProtected(), handlers.RevokeAPIKey)
+	api.Get("/me/identities", middleware.JWTProtected(), handlers.ListIdentities)
+	api.Post("/me/identities/:connector/start", middleware.JWTProtected(), handlers.LinkIdentityStart)
+	api.Post("/me/identities/:connector/callback", middleware.JWTProtected(), handlers.LinkIdentityCallback)
+	api.Delete("/me/identities/:id", middleware.JWTProtected(), handlers.UnlinkIdentity)
+	api.Get("/me/passkeys", middleware.JWTProtected(), handlers.ListPasskeys)
+	api.Post("/me/passkeys/register/begin", middleware.JWTProtected(), handlers.BeginPasskeyRegistration)
+	api.Post("/me/passkeys/register/finish", middleware.JWTProtected(), handlers.FinishPasskeyRegistration)
+	api.Post("/me/passkeys/challenge", middleware.JWTProtected(), handlers.BeginPasskeyReauth)
+	api.Patch("/me/passkeys/:id", middleware.JWTProtected(), handlers.RenamePasskey)
+	api.Delete("/me/passkeys/:id", middleware.JWTProtected(), middleware.RequireElevation(), handlers.DeletePasskey)
+	api.Get("/me/oauth/consents", middleware.JWTProtected(), handlers.ListOAuthConsents)
+	api.Delete("/me/oauth/consents/:client_id", middleware.JWTProtected(), handlers.RevokeOAuthConsent)
 
 	// Transactions
-	api.Get("/transactions", middleware.JWTProtected(), handlers.ListTransactions)
-	api.Post("/transactions", middleware.JWTProtected(), handlers.CreateTransaction)
+	api.Get("/transactions", middleware.JWTProtected(models.ScopeTransactionsRead), handlers.ListTransactions)
+	api.Post("/transactions", middleware.JWTProtected(models.ScopeTransactionsWrite), middleware.RequireVerifiedEmail(), handlers.CreateTransaction)
+	api.Get("/transactions/:id", middleware.JWTProtected(models.ScopeTransactionsRead), handlers.GetTransaction)
+	api.Put("/transactions/:id", middleware.JWTProtected(models.ScopeTransactionsWrite), middleware.RequireVerifiedEmail(), handlers.UpdateTransaction)
+	api.Patch("/transactions/:id", middleware.JWTProtected(models.ScopeTransactionsWrite), middleware.RequireVerifiedEmail(), handlers.UpdateTransaction)
+	api.Delete("/transactions/:id", middleware.JWTProtected(models.ScopeTransactionsWrite), handlers.DeleteTransaction)
+	api.Post("/transactions/:id/restore", middleware.JWTProtected(models.ScopeTransactionsWrite), middleware.RequireVerifiedEmail(), handlers.RestoreTransaction)
 
 	// Friends
-	friends := api.Group("/friends", middleware.JWTProtected())
-	friends.Get("/search", handlers.SearchUserByPhone)
-	friends.Post("/request", handlers.SendFriendRequest)
-	friends.Post("/accept", handlers.AcceptFriendRequestByPhone) // Accept with phone in body
-	friends.Post("/reject", handlers.RejectFriendRequestByPhone) // Reject with phone in body
-	friends.Post("/accept/:id", handlers.AcceptFriendRequest)    // Legacy: by ID
-	friends.Post("/reject/:id", handlers.RejectFriendRequest)    // Legacy: by ID
-	friends.Get("/list", handlers.ListFriends)
-	friends.Get("/pending", handlers.ListPendingRequests)
-	friends.Delete("/:id", handlers.DeleteFriend)
-	friends.Post("/:id/toggle-debt", handlers.ToggleDebt)
+	read := middleware.JWTProtected(models.ScopeFriendsRead)
+	write := middleware.JWTProtected(models.ScopeFriendsWrite)
+	friends := api.Group("/friends")
+	friends.Get("/search", read, handlers.SearchUserByPhone)
+	friends.Post("/request", write, middleware.RequireVerifiedEmail(), handlers.SendFriendRequest)
+	friends.Post("/accept", write, handlers.AcceptFriendRequestByPhone) // Accept with phone in body
+	friends.Post("/reject", write, handlers.RejectFriendRequestByPhone) // Reject with phone in body
+	friends.Post("/accept/:id", write, handlers.AcceptFriendRequest)    // Legacy: by ID
+	friends.Post("/reject/:id", write, handlers.RejectFriendRequest)    // Legacy: by ID
+	friends.Get("/list", read, handlers.ListFriends)
+	friends.Get("/pending", read, handlers.ListPendingRequests)
+	friends.Delete("/:id", write, middleware.RequireElevation(), handlers.DeleteFriend)
+	friends.Post("/:id/toggle-debt", write, handlers.ToggleDebt)
 
+	// Admin
+	admin := api.Group("/admin", middleware.JWTProtected())
+	admin.Get("/users", middleware.RequirePermission(models.PermUsersRead), handlers.AdminSearchUsers)
+	admin.Get("/users/:id", middleware.RequirePermission(models.PermUsersRead), handlers.AdminGetUser)
+	admin.Get("/users/:id/history", middleware.RequirePermission(models.PermHistoryRead), handlers.AdminUserHistory)
+	admin.Post("/users/:id/disable", middleware.RequirePermission(models.PermUsersManage), handlers.AdminDisableUser)
+	admin.Post("/users/:id/enable", middleware.RequirePermission(models.PermUsersManage), handlers.AdminEnableUser)
+	admin.Post("/users/:id/force-password-reset", middleware.RequirePermission(models.PermUsersManage), handlers.AdminForcePasswordReset)
+	admin.Put("/users/:id/state", middleware.RequirePermission(models.PermUsersManage), handlers.AdminSetAccountState)
+	admin.Post("/users/:id/unlock", middleware.RequirePermission(models.PermUsersUnlock), handlers.AdminUnlockUser)
+	admin.Put("/users/:id/roles", middleware.RequirePermission(models.PermRolesManage), handlers.AdminSetRoles)
+	admin.Get("/roles", middleware.RequirePermission(models.PermRolesManage), handlers.AdminListRoles)
+	admin.Get("/audit", middleware.RequirePermission(models.PermAuditRead), handlers.AdminAuditLog)
+	admin.Get("/oauth-clients", middleware.RequirePermission(models.PermClientsManage), handlers.AdminListOAuthClients)
+	admin.Post("/oauth-clients", middleware.RequirePermission(models.PermClientsManage), handlers.AdminCreateOAuthClient)
+	admin.Delete("/oauth-clients/:client_id", middleware.RequirePermission(models.PermClientsManage), handlers.AdminRevokeOAuthClient)
 }
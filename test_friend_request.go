@@ -6,26 +6,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 )
 
 // Quick test untuk SendFriendRequest endpoint
 func testSendFriendRequest() {
-	// First, login ke backend untuk dapatkan token
-	loginResp, err := http.Post(
-		"http://localhost:3000/api/v1/auth/login",
-		"application/json",
-		bytes.NewBufferString(`{"email":"teguh@example.com","password":"password123"}`),
-	)
-	if err != nil {
-		fmt.Printf("Login error: %v\n", err)
+	// Pakai API key dengan scope friends:write (buat di POST /api/v1/me/tokens)
+	token := os.Getenv("DOMPETKU_API_KEY")
+	if token == "" {
+		fmt.Println("Set DOMPETKU_API_KEY dulu")
 		return
 	}
-	defer loginResp.Body.Close()
-
-	var loginBody map[string]interface{}
-	json.NewDecoder(loginResp.Body).Decode(&loginBody)
-	token := loginBody["data"].(map[string]interface{})["token"].(string)
-	fmt.Printf("Token: %s\n", token)
 
 	// Test 1: Send friend request by phone
 	fmt.Println("\n=== Test 1: Send friend request by phone ===")
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"autentikasi/config"
+)
+
+// Token types carried in the typ claim. JWTProtected only accepts TokenAccess.
+const (
+	TokenAccess     = "access"
+	TokenMFAPending = "mfa_pending"
+	TokenElevated   = "elevated"
+
+	// TokenOAuthAccess is issued to OAuth clients and only accepted by the
+	// userinfo endpoint; its audience is the client.
+	TokenOAuthAccess = "oauth_access"
+)
+
+// Claims are the claims of every token we issue. Subject holds the user id
+// as a decimal string; ID (jti) is random so single tokens can be denylisted.
+type Claims struct {
+	Type      string `json:"typ"`
+	SessionID uint64 `json:"sid,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Nama      string `json:"nama,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewClaims fills the registered claims (iss, sub, aud, iat, nbf, exp, jti)
+// for a token of type typ. Internal tokens that never leave this service
+// pass no audience and get the issuer as audience.
+func NewClaims(typ string, userID uint64, audience []string, ttl time.Duration) (*Claims, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	issuer := config.Load().JWTIssuer
+	if len(audience) == 0 {
+		audience = []string{issuer}
+	}
+	now := time.Now()
+	return &Claims{
+		Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatUint(userID, 10),
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        jti,
+		},
+	}, nil
+}
+
+// UserID returns the subject as a user id, or 0 when it is not numeric.
+func (c *Claims) UserID() uint64 {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return id
+}
+
+// ParseJWT verifies signature, exp/nbf/iat and issuer, and that the token's
+// audience contains one of audiences (the issuer itself when none is given).
+func ParseJWT(tokenStr string, audiences ...string) (*Claims, error) {
+	claims, err := parseSigned(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if len(audiences) == 0 {
+		audiences = []string{claims.Issuer}
+	}
+	for _, want := range audiences {
+		for _, got := range claims.Audience {
+			if want == got {
+				return claims, nil
+			}
+		}
+	}
+	return nil, errors.New("invalid audience")
+}
+
+// ParseClientToken verifies a token issued to an OAuth client: the audience
+// must contain the client named by its client_id claim. Callers still have to
+// check that the client exists.
+func ParseClientToken(tokenStr string) (*Claims, error) {
+	claims, err := parseSigned(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ClientID != "" {
+		for _, got := range claims.Audience {
+			if got == claims.ClientID {
+				return claims, nil
+			}
+		}
+	}
+	return nil, errors.New("invalid audience")
+}
+
+func parseSigned(tokenStr string) (*Claims, error) {
+	if keys == nil {
+		return nil, errors.New("signing keys not initialized")
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keys.keyfunc,
+		jwt.WithValidMethods([]string{keys.alg}),
+		jwt.WithIssuer(config.Load().JWTIssuer),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
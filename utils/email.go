@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"fmt"
-	"math/rand"
+	"html"
+	"math/big"
 	"strconv"
 	"time"
 
@@ -12,9 +14,13 @@ import (
 	"gopkg.in/mail.v2"
 )
 
-// GenerateOTP creates a random 6-digit OTP
-func GenerateOTP() string {
-	return strconv.Itoa(rand.Intn(900000) + 100000)
+// GenerateOTP creates a random 6-digit OTP using crypto/rand
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
 // SendOTPEmail sends OTP to user email
@@ -50,14 +56,7 @@ func SendOTPEmail(cfg *config.Config, recipientEmail, otp string) error {
 
 	m.SetBody("text/html", body)
 
-	port, _ := strconv.Atoi(cfg.MailPort)
-	d := mail.NewDialer(cfg.MailServer, port, cfg.MailUsername, cfg.MailPassword)
-
-	// Configure TLS with ServerName and timeout
-	d.TLSConfig = &tls.Config{ServerName: cfg.MailServer}
-	d.Timeout = 10 * time.Second
-
-	if err := d.DialAndSend(m); err != nil {
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
 		return fmt.Errorf("failed to send OTP email: %w", err)
 	}
 	return nil
@@ -91,15 +90,292 @@ func SendPasswordResetSuccessEmail(cfg *config.Config, recipientEmail string) er
 
 	m.SetBody("text/html", body)
 
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send confirmation email: %w", err)
+	}
+	return nil
+}
+
+// SendVerificationEmail sends the e-mail address verification code and link
+func SendVerificationEmail(cfg *config.Config, recipientEmail, code, link string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Verifikasi E-mail - Dompetku")
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Verifikasi E-mail Dompetku</h2>
+        <p>Halo,</p>
+        <p>Terima kasih telah mendaftar di Dompetku. Masukkan kode di bawah ini di aplikasi untuk memverifikasi alamat e-mail Anda:</p>
+        
+        <div style="background-color: #f0f0f0; padding: 20px; border-radius: 5px; text-align: center; margin: 20px 0;">
+            <p style="font-size: 14px; color: #666; margin: 0 0 10px 0;">Kode verifikasi:</p>
+            <p style="font-size: 32px; font-weight: bold; color: #6b4cc9; letter-spacing: 5px; margin: 0;">%s</p>
+        </div>
+        
+        <p>Atau klik tautan berikut: <a href="%s">Verifikasi e-mail saya</a></p>
+        
+        <p style="color: #666;">Kode dan tautan ini berlaku selama 24 jam. Jika Anda tidak mendaftar di Dompetku, abaikan email ini.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, code, link)
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	return nil
+}
+
+// newDialer builds the SMTP dialer from config with TLS ServerName and timeout
+func newDialer(cfg *config.Config) *mail.Dialer {
 	port, _ := strconv.Atoi(cfg.MailPort)
 	d := mail.NewDialer(cfg.MailServer, port, cfg.MailUsername, cfg.MailPassword)
-
-	// Configure TLS with ServerName and timeout
 	d.TLSConfig = &tls.Config{ServerName: cfg.MailServer}
 	d.Timeout = 10 * time.Second
+	return d
+}
 
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("failed to send confirmation email: %w", err)
+// SendEmailChangeCode sends the confirmation code to the new e-mail address
+func SendEmailChangeCode(cfg *config.Config, recipientEmail, code string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Konfirmasi Perubahan E-mail - Dompetku")
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Konfirmasi E-mail Baru</h2>
+        <p>Halo,</p>
+        <p>Kami menerima permintaan untuk mengganti alamat e-mail akun Dompetku Anda ke alamat ini. Masukkan kode di bawah ini di aplikasi untuk mengonfirmasi:</p>
+        
+        <div style="background-color: #f0f0f0; padding: 20px; border-radius: 5px; text-align: center; margin: 20px 0;">
+            <p style="font-size: 14px; color: #666; margin: 0 0 10px 0;">Kode konfirmasi:</p>
+            <p style="font-size: 32px; font-weight: bold; color: #6b4cc9; letter-spacing: 5px; margin: 0;">%s</p>
+        </div>
+        
+        <p style="color: #666;">Kode ini berlaku selama 30 menit. Jika Anda tidak melakukan permintaan ini, abaikan email ini.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, code)
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email change code: %w", err)
+	}
+	return nil
+}
+
+// SendEmailChangedNotice tells the old e-mail address that the account moved to newEmail
+func SendEmailChangedNotice(cfg *config.Config, recipientEmail, newEmail string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "E-mail Akun Telah Diganti - Dompetku")
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">E-mail Akun Telah Diganti</h2>
+        <p>Halo,</p>
+        <p>Alamat e-mail akun Dompetku Anda telah diganti menjadi <b>%s</b>. E-mail ini tidak akan lagi menerima pemberitahuan akun.</p>
+        
+        <p style="margin-top: 30px; color: #666;">Jika ini bukan Anda, segera hubungi tim support kami.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, newEmail)
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email change notice: %w", err)
+	}
+	return nil
+}
+
+// SendPasswordChangedEmail notifies the user that their password was changed while logged in
+func SendPasswordChangedEmail(cfg *config.Config, recipientEmail string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Kata Sandi Telah Diubah - Dompetku")
+
+	body := `
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Kata Sandi Telah Diubah</h2>
+        <p>Halo,</p>
+        <p>Kata sandi akun Dompetku Anda baru saja diubah. Semua perangkat lain telah dikeluarkan dari akun.</p>
+        
+        <p style="margin-top: 30px; color: #666;">Jika ini bukan Anda, segera reset kata sandi Anda dan hubungi tim support kami.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send password changed email: %w", err)
+	}
+	return nil
+}
+
+// SendMagicLinkEmail sends a one-time login code and, when link is not
+// empty, a login link
+func SendMagicLinkEmail(cfg *config.Config, recipientEmail, code, link string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Kode Masuk - Dompetku")
+
+	linkHTML := ""
+	if link != "" {
+		linkHTML = fmt.Sprintf(`<p>Atau klik tautan berikut: <a href="%s">Masuk ke Dompetku</a></p>`, link)
+	}
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Masuk ke Dompetku</h2>
+        <p>Halo,</p>
+        <p>Kami menerima permintaan untuk masuk ke akun Dompetku Anda tanpa kata sandi. Masukkan kode di bawah ini di aplikasi:</p>
+        
+        <div style="background-color: #f0f0f0; padding: 20px; border-radius: 5px; text-align: center; margin: 20px 0;">
+            <p style="font-size: 14px; color: #666; margin: 0 0 10px 0;">Kode masuk:</p>
+            <p style="font-size: 32px; font-weight: bold; color: #6b4cc9; letter-spacing: 5px; margin: 0;">%s</p>
+        </div>
+        
+        %s
+        
+        <p style="color: #666;">Kode dan tautan ini hanya bisa dipakai sekali dan berlaku selama %d menit. Jika Anda tidak meminta ini, abaikan email ini dan jangan bagikan kode kepada siapa pun.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, code, linkHTML, int(cfg.MagicLinkTTL.Minutes()))
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send magic link email: %w", err)
+	}
+	return nil
+}
+
+// SendAccountDeletionEmail confirms a deletion request and says until when
+// it can be cancelled
+func SendAccountDeletionEmail(cfg *config.Config, recipientEmail string, purgeAt time.Time) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Akun Akan Dihapus - Dompetku")
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Permintaan Penghapusan Akun</h2>
+        <p>Halo,</p>
+        <p>Kami menerima permintaan untuk menghapus akun Dompetku Anda. Akun beserta seluruh transaksi, daftar teman, dan riwayatnya akan dihapus permanen pada <b>%s</b>.</p>
+        
+        <p>Berubah pikiran? Masuk ke aplikasi sebelum tanggal tersebut dan batalkan penghapusan akun.</p>
+        
+        <p style="margin-top: 30px; color: #666;">Jika ini bukan Anda, segera masuk, batalkan penghapusan, dan ubah kata sandi Anda.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, purgeAt.Format("02 Jan 2006 15:04 MST"))
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send account deletion email: %w", err)
+	}
+	return nil
+}
+
+// SendLoginAlertEmail tells the user about a login from a new device or an
+// unusual network, with a link to report it when it was not them
+func SendLoginAlertEmail(cfg *config.Config, recipientEmail, reason, device, ip string, at time.Time, link string) error {
+	m := mail.NewMessage()
+	m.SetHeader("From", cfg.MailDefaultSender)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Login Baru ke Akun Anda - Dompetku")
+
+	body := fmt.Sprintf(`
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #f5f5f5; padding: 20px;">
+    <div style="max-width: 600px; margin: 0 auto; background-color: white; padding: 20px; border-radius: 10px;">
+        <h2 style="color: #333;">Login Baru Terdeteksi</h2>
+        <p>Halo,</p>
+        <p>Akun Dompetku Anda baru saja digunakan untuk masuk dari %s.</p>
+        
+        <div style="background-color: #f0f0f0; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p style="margin: 0 0 5px 0;"><b>Waktu:</b> %s</p>
+            <p style="margin: 0 0 5px 0;"><b>Perangkat:</b> %s</p>
+            <p style="margin: 0;"><b>Alamat IP:</b> %s</p>
+        </div>
+        
+        <p>Jika ini Anda, abaikan email ini.</p>
+        
+        <p>Bukan Anda? <a href="%s" style="color: #6b4cc9; font-weight: bold;">Ini bukan saya</a>. Semua perangkat akan dikeluarkan dan akun Anda dikunci sampai kata sandi direset lewat fitur lupa kata sandi.</p>
+        
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Salam,<br>
+            Tim Dompetku
+        </p>
+    </div>
+</body>
+</html>
+	`, html.EscapeString(reason), at.Format("02 Jan 2006 15:04 MST"), html.EscapeString(device), html.EscapeString(ip), link)
+
+	m.SetBody("text/html", body)
+
+	if err := newDialer(cfg).DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send login alert email: %w", err)
 	}
 	return nil
 }
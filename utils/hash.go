@@ -1,18 +1,121 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"autentikasi/config"
+)
+
+// Hashes are self-describing so the algorithm and its parameters can change
+// without a migration: argon2id hashes use the PHC string format
+// ($argon2id$v=19$m=19456,t=2,p=1$salt$key) and bcrypt hashes keep their own
+// $2a$/$2b$ format with the cost inside. Check accepts both; NeedsRehash
+// reports hashes made with other settings than the current ones.
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func currentArgon2(cfg *config.Config) argon2Params {
+	return argon2Params{memory: uint32(cfg.Argon2Memory), time: uint32(cfg.Argon2Time), threads: uint8(cfg.Argon2Threads)}
+}
 
 func Hash(plain string) (string, error) {
 	if plain == "" {
 		return "", nil // biar kosong tidak di-hash
 	}
-	b, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
-	return string(b), err
+	cfg := config.Load()
+	if cfg.PasswordHashAlg == HashBcrypt {
+		b, err := bcrypt.GenerateFromPassword([]byte(plain), cfg.BcryptCost)
+		return string(b), err
+	}
+
+	p := currentArgon2(cfg)
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, p.time, p.memory, p.threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
 }
 
 func Check(plain, hashed string) bool {
 	if plain == "" || hashed == "" {
 		return false
 	}
+	if strings.HasPrefix(hashed, "$argon2id$") {
+		p, salt, key, err := parseArgon2(hashed)
+		if err != nil {
+			return false
+		}
+		got := argon2.IDKey([]byte(plain), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain)) == nil
 }
+
+// NeedsRehash reports whether hashed was made with another algorithm or
+// weaker parameters than currently configured. Call it after a successful
+// Check, while the plaintext is at hand.
+func NeedsRehash(hashed string) bool {
+	if hashed == "" {
+		return false
+	}
+	cfg := config.Load()
+	if strings.HasPrefix(hashed, "$argon2id$") {
+		if cfg.PasswordHashAlg == HashBcrypt {
+			return true
+		}
+		p, _, _, err := parseArgon2(hashed)
+		return err != nil || p != currentArgon2(cfg)
+	}
+	if cfg.PasswordHashAlg != HashBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return err != nil || cost != cfg.BcryptCost
+}
+
+func parseArgon2(hashed string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	if p.time == 0 || p.threads == 0 || p.memory < 8*uint32(p.threads) {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id key")
+	}
+	return p, salt, key, nil
+}
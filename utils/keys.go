@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"autentikasi/config"
+)
+
+// signingKey is one private key from JWT_KEY_DIR. The kid is the file name
+// without extension. Generated keys are named after their creation time
+// (kidTimeFormat), which gives their age; copying or restoring the files
+// does not change it the way it changes the modification time.
+type signingKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+// keySet signs tokens with the newest key and verifies with every key that
+// is still inside its grace period. With JWT_ALG=HS256 it falls back to the
+// shared JWT_SECRET and publishes no JWKS.
+type keySet struct {
+	mu       sync.RWMutex
+	alg      string
+	dir      string
+	secret   []byte
+	rotation time.Duration
+	grace    time.Duration
+	keys     []*signingKey // newest first
+}
+
+var keys *keySet
+
+// kidTimeFormat is the UTC creation time at the start of generated kids.
+const kidTimeFormat = "20060102T150405"
+
+// InitKeys loads the signing keys described by cfg and, for asymmetric
+// algorithms, starts the background rotation loop.
+func InitKeys(cfg *config.Config) error {
+	ks := &keySet{
+		alg:      strings.ToUpper(cfg.JWTAlg),
+		dir:      cfg.JWTKeyDir,
+		secret:   []byte(cfg.JWTSecret),
+		rotation: cfg.JWTKeyRotation,
+		grace:    cfg.JWTKeyGrace,
+	}
+	if ks.alg == "EDDSA" {
+		ks.alg = "EdDSA"
+	}
+	switch ks.alg {
+	case "HS256":
+		if cfg.JWTSecret == config.DefaultJWTSecret {
+			return errors.New("JWT_SECRET must be set to a random secret for HS256")
+		}
+		keys = ks
+		return nil
+	case "RS256", "EdDSA":
+	default:
+		return fmt.Errorf("unsupported JWT_ALG %q", cfg.JWTAlg)
+	}
+	if ks.dir == "" {
+		return errors.New("JWT_KEY_DIR is required for " + ks.alg)
+	}
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return err
+	}
+	if err := ks.refresh(); err != nil {
+		return err
+	}
+	keys = ks
+	go ks.rotateLoop()
+	return nil
+}
+
+// SignJWT signs claims with the current signing key and sets the kid header.
+func SignJWT(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys not initialized")
+	}
+	if keys.alg == "HS256" {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(keys.secret)
+	}
+	keys.mu.RLock()
+	if len(keys.keys) == 0 {
+		keys.mu.RUnlock()
+		return "", errors.New("no signing key available")
+	}
+	k := keys.keys[0]
+	keys.mu.RUnlock()
+
+	t := jwt.NewWithClaims(k.Method, claims)
+	t.Header["kid"] = k.ID
+	return t.SignedString(k.Private)
+}
+
+// SigningAlg returns the JWS algorithm tokens are signed with.
+func SigningAlg() string {
+	if keys == nil {
+		return ""
+	}
+	return keys.alg
+}
+
+// JWKS returns the public keys that currently verify tokens, in JSON Web Key
+// Set format, so other services can verify our tokens offline.
+func JWKS() map[string]interface{} {
+	set := []map[string]interface{}{}
+	if keys == nil || keys.alg == "HS256" {
+		return map[string]interface{}{"keys": set}
+	}
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	for _, k := range keys.keys {
+		jwk := map[string]interface{}{"kid": k.ID, "use": "sig", "alg": k.Method.Alg()}
+		switch pub := k.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set = append(set, jwk)
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+func (ks *keySet) keyfunc(t *jwt.Token) (interface{}, error) {
+	if ks.alg == "HS256" {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return ks.secret, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			if t.Method.Alg() != k.Method.Alg() {
+				return nil, errors.New("unexpected signing method")
+			}
+			return k.Private.Public(), nil
+		}
+	}
+	return nil, errors.New("unknown kid")
+}
+
+// rotateLoop periodically reloads the key directory (picking up keys added
+// by other instances) and creates a new key once the current one is older
+// than JWT_KEY_ROTATION.
+func (ks *keySet) rotateLoop() {
+	interval := time.Hour
+	if ks.rotation > 0 && ks.rotation/10 < interval {
+		interval = ks.rotation / 10
+	}
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		if err := ks.refresh(); err != nil {
+			log.Printf("[Keys] rotation failed: %v", err)
+		}
+	}
+}
+
+// refresh loads keys from disk, generates a new key when rotation is due and
+// drops keys whose grace period after being superseded has passed.
+func (ks *keySet) refresh() error {
+	loaded, err := ks.load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if len(loaded) == 0 || (ks.rotation > 0 && now.Sub(loaded[0].CreatedAt) >= ks.rotation) {
+		k, err := ks.generate()
+		if err != nil {
+			return err
+		}
+		log.Printf("[Keys] generated new %s signing key %s", ks.alg, k.ID)
+		loaded = append([]*signingKey{k}, loaded...)
+	}
+
+	// A key stops verifying once it has been superseded for longer than grace.
+	active := loaded[:1]
+	for i := 1; i < len(loaded); i++ {
+		if now.Sub(loaded[i-1].CreatedAt) <= ks.grace {
+			active = append(active, loaded[i])
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = active
+	ks.mu.Unlock()
+	return nil
+}
+
+// load reads every *.pem private key in the directory that matches the
+// configured algorithm, newest first.
+func (ks *keySet) load() ([]*signingKey, error) {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*signingKey
+	for _, f := range files {
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := parsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		method := methodFor(signer)
+		if method == nil || method.Alg() != ks.alg {
+			continue
+		}
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		created, err := keyCreatedAt(f, kid)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &signingKey{
+			ID:        kid,
+			Method:    method,
+			Private:   signer,
+			CreatedAt: created,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// generate creates a key for the configured algorithm and stores it as
+// PKCS#8 PEM named after its kid.
+func (ks *keySet) generate() (*signingKey, error) {
+	var signer crypto.Signer
+	var err error
+	if ks.alg == "RS256" {
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	kid := now.UTC().Format(kidTimeFormat) + "-" + hex.EncodeToString(suffix)
+	path := filepath.Join(ks.dir, kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return &signingKey{ID: kid, Method: methodFor(signer), Private: signer, CreatedAt: now}, nil
+}
+
+// keyCreatedAt reads the creation time from a generated kid. Keys placed in
+// the directory by hand under another name fall back to the file's
+// modification time.
+func keyCreatedAt(path, kid string) (time.Time, error) {
+	if len(kid) >= len(kidTimeFormat) {
+		if t, err := time.Parse(kidTimeFormat, kid[:len(kidTimeFormat)]); err == nil {
+			return t, nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func parsePrivateKey(raw []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func methodFor(signer crypto.Signer) jwt.SigningMethod {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
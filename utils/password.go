@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"autentikasi/config"
+)
+
+// PasswordError is a password policy violation. It carries the message in
+// Indonesian (the default) and English; Code is stable for clients.
+type PasswordError struct {
+	Code string
+	ID   string
+	EN   string
+}
+
+func (e *PasswordError) Error() string { return e.ID }
+
+// Message returns the message for lang ("en" or "id").
+func (e *PasswordError) Message(lang string) string {
+	if lang == "en" {
+		return e.EN
+	}
+	return e.ID
+}
+
+var (
+	ErrPasswordBreached = &PasswordError{
+		Code: "password_breached",
+		ID:   "Kata sandi ini pernah bocor di situs lain. Pilih kata sandi lain",
+		EN:   "This password has appeared in a data breach. Choose a different one",
+	}
+	ErrPasswordReused = &PasswordError{
+		Code: "password_reused",
+		ID:   "Kata sandi ini sudah pernah kamu gunakan. Pilih kata sandi lain",
+		EN:   "You have used this password before. Choose a different one",
+	}
+)
+
+var passwordClasses = map[string]struct {
+	match  func(rune) bool
+	id, en string
+}{
+	"letter": {unicode.IsLetter, "huruf", "a letter"},
+	"lower":  {unicode.IsLower, "huruf kecil", "a lowercase letter"},
+	"upper":  {unicode.IsUpper, "huruf besar", "an uppercase letter"},
+	"digit":  {unicode.IsDigit, "angka", "a digit"},
+	"symbol": {func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) }, "simbol", "a symbol"},
+}
+
+// CheckPasswordPolicy applies the configured length and character-class
+// rules and rejects passwords that contain the user's e-mail name or name.
+// It does not look at password history or breach lists.
+func CheckPasswordPolicy(cfg *config.Config, password, email, name string) *PasswordError {
+	if n := len([]rune(password)); n < cfg.PasswordMinLength {
+		return &PasswordError{
+			Code: "password_too_short",
+			ID:   fmt.Sprintf("Kata sandi minimal %d karakter", cfg.PasswordMinLength),
+			EN:   fmt.Sprintf("Password must be at least %d characters", cfg.PasswordMinLength),
+		}
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything after 72 bytes.
+		return &PasswordError{
+			Code: "password_too_long",
+			ID:   "Kata sandi maksimal 72 karakter",
+			EN:   "Password must be at most 72 characters",
+		}
+	}
+
+	var missingID, missingEN []string
+	for _, class := range cfg.PasswordClasses {
+		cc, ok := passwordClasses[strings.ToLower(class)]
+		if !ok || strings.IndexFunc(password, cc.match) >= 0 {
+			continue
+		}
+		missingID = append(missingID, cc.id)
+		missingEN = append(missingEN, cc.en)
+	}
+	if len(missingID) > 0 {
+		return &PasswordError{
+			Code: "password_too_simple",
+			ID:   "Kata sandi harus mengandung " + joinList(missingID, "dan"),
+			EN:   "Password must contain " + joinList(missingEN, "and"),
+		}
+	}
+
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	personal := []string{local}
+	personal = append(personal, strings.Fields(strings.ToLower(name))...)
+	for _, part := range personal {
+		if len([]rune(part)) >= 3 && strings.Contains(lower, part) {
+			return &PasswordError{
+				Code: "password_personal",
+				ID:   "Kata sandi tidak boleh mengandung nama atau e-mail kamu",
+				EN:   "Password must not contain your name or e-mail address",
+			}
+		}
+	}
+	return nil
+}
+
+func joinList(items []string, and string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + and + " " + items[len(items)-1]
+}
+
+// PasswordBreached looks the password up in a local copy of a breached
+// password list split k-anonymity style: dir holds one file per 5-character
+// SHA-1 prefix (optionally with a .txt extension), each line "SUFFIX:COUNT".
+// A missing prefix file means the password is not listed.
+func PasswordBreached(dir, password string) (bool, error) {
+	if dir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	f, err := os.Open(filepath.Join(dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		// Padded range responses list fake suffixes with a count of 0.
+		if strings.EqualFold(line, suffix) && strings.TrimSpace(count) != "0" {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 func Ok(c *fiber.Ctx, status int, data interface{}) error {
@@ -26,8 +25,3 @@ func Fail(c *fiber.Ctx, status int, msg string) error {
 func FiberErrorHandler(c *fiber.Ctx, err error) error {
 	return Fail(c, fiber.StatusInternalServerError, err.Error())
 }
-
-func SignJWT(secret string, claims jwt.MapClaims) (string, error) {
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString([]byte(secret))
-}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"autentikasi/config"
+)
+
+// RandomToken returns a URL-safe string built from n random bytes.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 digest of an opaque token. Tokens are
+// stored by digest so a database leak does not expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashCode returns the hex HMAC-SHA256 of a short one-time code under
+// CODE_HASH_KEY. A 6-digit code has too few values for a plain digest, and
+// a slow password hash for every guess would only burn server CPU; the
+// attempt limit is what stops guessing.
+func HashCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(config.Load().CodeHashKey))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCode compares code with a HashCode digest. Codes issued before
+// HashCode carry a password hash ($argon2id$, $2a$) and are checked with
+// Check until they expire.
+func CheckCode(code, hashed string) bool {
+	if code == "" || hashed == "" {
+		return false
+	}
+	if strings.HasPrefix(hashed, "$") {
+		return Check(code, hashed)
+	}
+	return subtle.ConstantTimeCompare([]byte(HashCode(code)), []byte(hashed)) == 1
+}
+
+// VerifyPKCE checks an OAuth PKCE code_verifier against the S256
+// code_challenge sent with the authorization request (RFC 7636).
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	got := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(got), []byte(challenge)) == 1
+}
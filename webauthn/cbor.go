@@ -0,0 +1,124 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCBOR = errors.New("webauthn: malformed CBOR")
+
+// decodeCBOR decodes the first CBOR item of b and returns it with the number
+// of bytes it used. It supports what WebAuthn needs: integers (as int64),
+// byte and text strings, arrays, maps (keys are int64 or string), booleans,
+// null and floats. Indefinite lengths and tags are rejected.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	return decodeItem(b, 0)
+}
+
+func decodeItem(b []byte, depth int) (interface{}, int, error) {
+	if depth > 16 || len(b) == 0 {
+		return nil, 0, errCBOR
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	arg, n, err := readArg(b, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, 0, errCBOR
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, 0, errCBOR
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errCBOR
+		}
+		end := n + int(arg)
+		if major == 2 {
+			out := make([]byte, arg)
+			copy(out, b[n:end])
+			return out, end, nil
+		}
+		return string(b[n:end]), end, nil
+	case 4:
+		if arg > uint64(len(b)) {
+			return nil, 0, errCBOR
+		}
+		out := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, used, err := decodeItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			out = append(out, v)
+			n += used
+		}
+		return out, n, nil
+	case 5:
+		if arg > uint64(len(b)) {
+			return nil, 0, errCBOR
+		}
+		out := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, used, err := decodeItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errCBOR
+			}
+			v, used, err := decodeItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			out[k] = v
+		}
+		return out, n, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22, 23:
+			return nil, n, nil
+		case 25:
+			return float64(arg), n, nil // half floats are not needed; keep the raw bits
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), n, nil
+		case 27:
+			return math.Float64frombits(arg), n, nil
+		}
+	}
+	return nil, 0, errCBOR
+}
+
+// readArg reads the argument that follows an initial byte with additional
+// information info and returns it with the header length.
+func readArg(b []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(b) >= 2:
+		return uint64(b[1]), 2, nil
+	case info == 25 && len(b) >= 3:
+		return uint64(binary.BigEndian.Uint16(b[1:])), 3, nil
+	case info == 26 && len(b) >= 5:
+		return uint64(binary.BigEndian.Uint32(b[1:])), 5, nil
+	case info == 27 && len(b) >= 9:
+		return binary.BigEndian.Uint64(b[1:]), 9, nil
+	}
+	return 0, 0, errCBOR
+}
@@ -0,0 +1,292 @@
+// Package softauthn is a software WebAuthn authenticator. It produces the
+// same JSON a browser sends after navigator.credentials.create() and get(),
+// so the passkey endpoints can be exercised from Go tests and scripts
+// without a security key. It uses ES256 keys unless Alg says otherwise, and
+// "none" attestation.
+package softauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+
+	"autentikasi/dto"
+)
+
+const (
+	flagUP = 0x01
+	flagUV = 0x04
+	flagAT = 0x40
+)
+
+// COSE algorithms the authenticator can create keys for.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var b64 = base64.RawURLEncoding
+
+type credential struct {
+	id         []byte
+	alg        int
+	key        crypto.Signer
+	userHandle []byte
+	signCount  uint32
+}
+
+// Authenticator holds the passkeys it created, for one relying party.
+type Authenticator struct {
+	RPID   string
+	Origin string
+	AAGUID [16]byte
+
+	// UserVerified sets the UV flag, as if the user entered a PIN or used
+	// a fingerprint. It is on by default.
+	UserVerified bool
+	// Counter makes the authenticator increment a sign counter; when false
+	// it always reports 0, like most synced passkeys.
+	Counter bool
+	// Alg is the COSE algorithm of the passkeys Create makes: AlgES256
+	// (the default), AlgEdDSA or AlgRS256.
+	Alg int
+
+	mu    sync.Mutex
+	creds []*credential
+}
+
+// New returns an authenticator for the relying party rpID used from origin.
+func New(rpID, origin string) *Authenticator {
+	return &Authenticator{RPID: rpID, Origin: origin, UserVerified: true, Counter: true, Alg: AlgES256}
+}
+
+// Create registers a new passkey for the base64url challenge and user handle
+// from the registration options.
+func (a *Authenticator) Create(challenge, userHandle string) (dto.WebAuthnCredential, error) {
+	handle, err := b64.DecodeString(userHandle)
+	if err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+	key, err := newKey(a.Alg)
+	if err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+	cred := &credential{id: make([]byte, 32), alg: a.Alg, key: key, userHandle: handle}
+	if _, err := rand.Read(cred.id); err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+
+	clientData, err := a.clientData("webauthn.create", challenge)
+	if err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+	authData := a.authData(flagAT, cred.signCount)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, coseKey(key.Public())...)
+
+	var att []byte
+	att = appendHead(att, 5, 3)
+	att = appendText(att, "fmt")
+	att = appendText(att, "none")
+	att = appendText(att, "attStmt")
+	att = appendHead(att, 5, 0)
+	att = appendText(att, "authData")
+	att = appendBytes(att, authData)
+
+	a.mu.Lock()
+	a.creds = append(a.creds, cred)
+	a.mu.Unlock()
+
+	id := b64.EncodeToString(cred.id)
+	return dto.WebAuthnCredential{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.WebAuthnCredentialResponse{
+			ClientDataJSON:    b64.EncodeToString(clientData),
+			AttestationObject: b64.EncodeToString(att),
+			Transports:        []string{"internal"},
+		},
+	}, nil
+}
+
+// Get signs an assertion for the base64url challenge with the first passkey
+// whose ID is in allowed, or with the newest passkey when allowed is empty
+// (a discoverable-credential login).
+func (a *Authenticator) Get(challenge string, allowed ...string) (dto.WebAuthnCredential, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	for i := len(a.creds) - 1; i >= 0 && cred == nil; i-- {
+		id := b64.EncodeToString(a.creds[i].id)
+		if len(allowed) == 0 {
+			cred = a.creds[i]
+		}
+		for _, want := range allowed {
+			if want == id {
+				cred = a.creds[i]
+			}
+		}
+	}
+	if cred == nil {
+		return dto.WebAuthnCredential{}, errors.New("softauthn: no matching credential")
+	}
+
+	clientData, err := a.clientData("webauthn.get", challenge)
+	if err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+	if a.Counter {
+		cred.signCount++
+	}
+	authData := a.authData(0, cred.signCount)
+	cdHash := sha256.Sum256(clientData)
+	sig, err := sign(cred, append(append([]byte{}, authData...), cdHash[:]...))
+	if err != nil {
+		return dto.WebAuthnCredential{}, err
+	}
+
+	id := b64.EncodeToString(cred.id)
+	return dto.WebAuthnCredential{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.WebAuthnCredentialResponse{
+			ClientDataJSON:    b64.EncodeToString(clientData),
+			AuthenticatorData: b64.EncodeToString(authData),
+			Signature:         b64.EncodeToString(sig),
+			UserHandle:        b64.EncodeToString(cred.userHandle),
+		},
+	}, nil
+}
+
+func (a *Authenticator) clientData(typ, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func (a *Authenticator) authData(flags byte, signCount uint32) []byte {
+	rpHash := sha256.Sum256([]byte(a.RPID))
+	flags |= flagUP
+	if a.UserVerified {
+		flags |= flagUV
+	}
+	out := append(rpHash[:], flags)
+	return binary.BigEndian.AppendUint32(out, signCount)
+}
+
+func newKey(alg int) (crypto.Signer, error) {
+	switch alg {
+	case AlgES256, 0:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, errors.New("softauthn: unsupported algorithm")
+}
+
+// sign signs msg the way alg specifies: EdDSA over the message itself, the
+// others over its SHA-256 digest.
+func sign(cred *credential, msg []byte) ([]byte, error) {
+	if cred.alg == AlgEdDSA {
+		return cred.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(msg)
+	return cred.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// coseKey encodes a public key as a COSE_Key.
+func coseKey(pub crypto.PublicKey) []byte {
+	var b []byte
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		b = appendHead(b, 5, 5)
+		b = appendInt(b, 1) // kty: EC2
+		b = appendInt(b, 2)
+		b = appendInt(b, 3) // alg: ES256
+		b = appendInt(b, AlgES256)
+		b = appendInt(b, -1) // crv: P-256
+		b = appendInt(b, 1)
+		b = appendInt(b, -2) // x
+		b = appendBytes(b, x)
+		b = appendInt(b, -3) // y
+		b = appendBytes(b, y)
+	case ed25519.PublicKey:
+		b = appendHead(b, 5, 4)
+		b = appendInt(b, 1) // kty: OKP
+		b = appendInt(b, 1)
+		b = appendInt(b, 3) // alg: EdDSA
+		b = appendInt(b, AlgEdDSA)
+		b = appendInt(b, -1) // crv: Ed25519
+		b = appendInt(b, 6)
+		b = appendInt(b, -2) // x
+		b = appendBytes(b, k)
+	case *rsa.PublicKey:
+		b = appendHead(b, 5, 4)
+		b = appendInt(b, 1) // kty: RSA
+		b = appendInt(b, 3)
+		b = appendInt(b, 3) // alg: RS256
+		b = appendInt(b, AlgRS256)
+		b = appendInt(b, -1) // n
+		b = appendBytes(b, k.N.Bytes())
+		b = appendInt(b, -2) // e
+		b = appendBytes(b, big.NewInt(int64(k.E)).Bytes())
+	}
+	return b
+}
+
+// Minimal CBOR encoding: just the heads, integers and strings used above.
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), n)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, 1, uint64(-1-v))
+	}
+	return appendHead(b, 0, uint64(v))
+}
+
+func appendBytes(b, v []byte) []byte {
+	return append(appendHead(b, 2, uint64(len(v))), v...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, 3, uint64(len(s))), s...)
+}
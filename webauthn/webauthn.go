@@ -0,0 +1,294 @@
+// Package webauthn verifies WebAuthn (passkey) registration and assertion
+// responses for a single relying party. It implements the parts of the
+// spec this service needs: "none" attestation, ES256, EdDSA and RS256
+// credential keys, user presence/verification flags and sign counters.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"autentikasi/config"
+)
+
+// COSE algorithm identifiers offered in pubKeyCredParams, preferred first.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagAttestedCredData = 0x40
+)
+
+var (
+	ErrChallenge     = errors.New("webauthn: challenge mismatch")
+	ErrOrigin        = errors.New("webauthn: origin not allowed")
+	ErrRPID          = errors.New("webauthn: RP ID mismatch")
+	ErrUserPresence  = errors.New("webauthn: user not present")
+	ErrUserVerify    = errors.New("webauthn: user verification required")
+	ErrSignature     = errors.New("webauthn: invalid signature")
+	ErrCloned        = errors.New("webauthn: sign counter did not increase; authenticator may be cloned")
+	ErrUnsupported   = errors.New("webauthn: unsupported credential key")
+	ErrAuthenticator = errors.New("webauthn: malformed authenticator data")
+)
+
+// RelyingParty is this service as WebAuthn sees it. ID is the domain the
+// passkeys are bound to; Origins are the web origins allowed to use them.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// FromConfig returns the relying party described by cfg.
+func FromConfig(cfg *config.Config) *RelyingParty {
+	return &RelyingParty{ID: cfg.WebAuthnRPID, Name: cfg.WebAuthnRPName, Origins: cfg.WebAuthnOrigins}
+}
+
+// Credential is a newly registered passkey.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key, as sent by the authenticator
+	SignCount      uint32
+	AAGUID         []byte
+	UserVerified   bool
+	BackupEligible bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ClientDataChallenge returns the challenge embedded in clientDataJSON so the
+// caller can look up the ceremony it belongs to. It verifies nothing.
+func ClientDataChallenge(clientDataJSON []byte) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(cd.Challenge)
+}
+
+func (rp *RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return errors.New("webauthn: unexpected clientData type " + cd.Type)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return ErrChallenge
+	}
+	for _, o := range rp.Origins {
+		if o == cd.Origin {
+			return nil
+		}
+	}
+	return ErrOrigin
+}
+
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	aaguid    []byte
+	credID    []byte
+	credKey   []byte
+}
+
+func parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, ErrAuthenticator
+	}
+	ad := &authData{rpIDHash: b[:32], flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	if ad.flags&flagAttestedCredData == 0 {
+		return ad, nil
+	}
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, ErrAuthenticator
+	}
+	ad.aaguid = rest[:16]
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < n {
+		return nil, ErrAuthenticator
+	}
+	ad.credID = rest[:n]
+	_, used, err := decodeCBOR(rest[n:])
+	if err != nil {
+		return nil, ErrAuthenticator
+	}
+	ad.credKey = rest[n : n+used]
+	return ad, nil
+}
+
+func (rp *RelyingParty) checkAuthData(ad *authData, requireUV bool) error {
+	sum := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, sum[:]) {
+		return ErrRPID
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return ErrUserVerify
+	}
+	return nil
+}
+
+// VerifyRegistration checks a navigator.credentials.create() response for
+// challenge and returns the new credential. Attestation statements are not
+// verified: the options ask for "none", so any format is accepted as is.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUV bool) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, errCBOR
+	}
+	raw, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, ErrAuthenticator
+	}
+	ad, err := parseAuthData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.credID == nil {
+		return nil, ErrAuthenticator
+	}
+	if _, err := parseCOSEKey(ad.credKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:             ad.credID,
+		PublicKey:      ad.credKey,
+		SignCount:      ad.signCount,
+		AAGUID:         ad.aaguid,
+		UserVerified:   ad.flags&flagUserVerified != 0,
+		BackupEligible: ad.flags&flagBackupEligible != 0,
+	}, nil
+}
+
+// Assertion is the outcome of a verified navigator.credentials.get().
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyAssertion checks a navigator.credentials.get() response for
+// challenge against a stored credential key and sign counter.
+func (rp *RelyingParty) VerifyAssertion(challenge, clientDataJSON, authenticatorData, signature, publicKey []byte, storedCount uint32, requireUV bool) (*Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	ad, err := parseAuthData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad, requireUV); err != nil {
+		return nil, err
+	}
+
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	cdHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), cdHash[:]...)
+	if !verifySignature(key, signed, signature) {
+		return nil, ErrSignature
+	}
+
+	// Authenticators that do not count always send 0 (most synced passkeys).
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return nil, ErrCloned
+	}
+	return &Assertion{SignCount: ad.signCount, UserVerified: ad.flags&flagUserVerified != 0}, nil
+}
+
+// parseCOSEKey turns a COSE_Key into an ecdsa, ed25519 or rsa public key.
+func parseCOSEKey(b []byte) (crypto.PublicKey, error) {
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupported
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupported
+		}
+		return pub, nil
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupported
+		}
+		return ed25519.PublicKey(x), nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupported
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+func verifySignature(key crypto.PublicKey, msg, sig []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(msg)
+		return ecdsa.VerifyASN1(k, h[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig)
+	case *rsa.PublicKey:
+		h := sha256.Sum256(msg)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+	}
+	return false
+}
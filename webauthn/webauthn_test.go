@@ -0,0 +1,337 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"autentikasi/dto"
+	"autentikasi/webauthn/softauthn"
+)
+
+const (
+	testRPID   = "dompetku.test"
+	testOrigin = "https://dompetku.test"
+)
+
+var b64 = base64.RawURLEncoding
+
+func testRP() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "Dompetku", Origins: []string{testOrigin}}
+}
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// register creates a passkey with auth and verifies it.
+func register(t *testing.T, rp *RelyingParty, auth *softauthn.Authenticator, requireUV bool) (*Credential, error) {
+	t.Helper()
+	challenge := []byte("registration-challenge")
+	resp, err := auth.Create(b64.EncodeToString(challenge), b64.EncodeToString([]byte("user-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp.VerifyRegistration(challenge, decode(t, resp.Response.ClientDataJSON), decode(t, resp.Response.AttestationObject), requireUV)
+}
+
+// assert signs challenge with auth and verifies it against cred.
+func assert(t *testing.T, rp *RelyingParty, auth *softauthn.Authenticator, cred *Credential, challenge []byte, storedCount uint32, requireUV bool) (*Assertion, error) {
+	t.Helper()
+	resp, err := auth.Get(b64.EncodeToString(challenge), b64.EncodeToString(cred.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verify(t, rp, resp, cred, challenge, storedCount, requireUV)
+}
+
+func verify(t *testing.T, rp *RelyingParty, resp dto.WebAuthnCredential, cred *Credential, challenge []byte, storedCount uint32, requireUV bool) (*Assertion, error) {
+	t.Helper()
+	r := resp.Response
+	return rp.VerifyAssertion(challenge, decode(t, r.ClientDataJSON), decode(t, r.AuthenticatorData), decode(t, r.Signature), cred.PublicKey, storedCount, requireUV)
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	algs := []struct {
+		name string
+		alg  int
+	}{
+		{"ES256", softauthn.AlgES256},
+		{"EdDSA", softauthn.AlgEdDSA},
+		{"RS256", softauthn.AlgRS256},
+	}
+	for _, a := range algs {
+		t.Run(a.name, func(t *testing.T) {
+			rp := testRP()
+			auth := softauthn.New(testRPID, testOrigin)
+			auth.Alg = a.alg
+
+			cred, err := register(t, rp, auth, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cred.UserVerified || cred.SignCount != 0 || len(cred.ID) != 32 {
+				t.Fatalf("credential = %+v", cred)
+			}
+			if _, err := ClientDataChallenge([]byte(`{"challenge":"` + b64.EncodeToString([]byte("x")) + `"}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			var count uint32
+			for i := 0; i < 2; i++ {
+				got, err := assert(t, rp, auth, cred, []byte("login-challenge"), count, true)
+				if err != nil {
+					t.Fatalf("assertion %d: %v", i, err)
+				}
+				if got.SignCount != count+1 || !got.UserVerified {
+					t.Fatalf("assertion %d = %+v", i, got)
+				}
+				count = got.SignCount
+			}
+		})
+	}
+}
+
+func TestAssertionWithoutCounter(t *testing.T) {
+	rp := testRP()
+	auth := softauthn.New(testRPID, testOrigin)
+	auth.Counter = false
+	cred, err := register(t, rp, auth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Synced passkeys always report 0; that is not a clone.
+	for i := 0; i < 2; i++ {
+		if _, err := assert(t, rp, auth, cred, []byte("c"), 0, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRejectRegistration(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(auth *softauthn.Authenticator)
+		uv    bool
+		want  error
+	}{
+		{
+			name:  "other origin",
+			setup: func(auth *softauthn.Authenticator) { auth.Origin = "https://evil.test" },
+			want:  ErrOrigin,
+		},
+		{
+			name:  "other RP ID",
+			setup: func(auth *softauthn.Authenticator) { auth.RPID = "evil.test" },
+			want:  ErrRPID,
+		},
+		{
+			name:  "UV required but missing",
+			setup: func(auth *softauthn.Authenticator) { auth.UserVerified = false },
+			uv:    true,
+			want:  ErrUserVerify,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			auth := softauthn.New(testRPID, testOrigin)
+			tt.setup(auth)
+			if _, err := register(t, rp, auth, tt.uv); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("other challenge", func(t *testing.T) {
+		rp := testRP()
+		resp, err := softauthn.New(testRPID, testOrigin).Create(b64.EncodeToString([]byte("old")), b64.EncodeToString([]byte("u")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rp.VerifyRegistration([]byte("new"), decode(t, resp.Response.ClientDataJSON), decode(t, resp.Response.AttestationObject), false)
+		if !errors.Is(err, ErrChallenge) {
+			t.Fatalf("err = %v, want %v", err, ErrChallenge)
+		}
+	})
+
+	t.Run("UV not required", func(t *testing.T) {
+		auth := softauthn.New(testRPID, testOrigin)
+		auth.UserVerified = false
+		cred, err := register(t, testRP(), auth, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cred.UserVerified {
+			t.Fatal("UserVerified set without the UV flag")
+		}
+	})
+}
+
+func TestRejectAssertion(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(auth *softauthn.Authenticator)
+		stored func(count uint32) uint32
+		uv     bool
+		want   error
+	}{
+		{name: "other origin", change: func(a *softauthn.Authenticator) { a.Origin = "https://evil.test" }, want: ErrOrigin},
+		{name: "other RP ID", change: func(a *softauthn.Authenticator) { a.RPID = "evil.test" }, want: ErrRPID},
+		{name: "UV required but missing", change: func(a *softauthn.Authenticator) { a.UserVerified = false }, uv: true, want: ErrUserVerify},
+		{name: "replayed counter", stored: func(c uint32) uint32 { return c + 1 }, want: ErrCloned},
+		{name: "counter went backwards", stored: func(c uint32) uint32 { return c + 10 }, want: ErrCloned},
+		{name: "counter reset to 0", change: func(a *softauthn.Authenticator) { a.Counter = false }, stored: func(uint32) uint32 { return 5 }, want: ErrCloned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			auth := softauthn.New(testRPID, testOrigin)
+			cred, err := register(t, rp, auth, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tt.change(auth)
+			}
+			stored := cred.SignCount
+			if tt.stored != nil {
+				stored = tt.stored(stored)
+			}
+			if _, err := assert(t, rp, auth, cred, []byte("c"), stored, tt.uv); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	rp := testRP()
+	auth := softauthn.New(testRPID, testOrigin)
+	cred, err := register(t, rp, auth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("other challenge", func(t *testing.T) {
+		resp, err := auth.Get(b64.EncodeToString([]byte("old")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verify(t, rp, resp, cred, []byte("new"), 0, true); !errors.Is(err, ErrChallenge) {
+			t.Fatalf("err = %v, want %v", err, ErrChallenge)
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		reg, err := auth.Create(b64.EncodeToString([]byte("c")), b64.EncodeToString([]byte("u")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		get, err := auth.Get(b64.EncodeToString([]byte("c")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A webauthn.create client data may not stand in for a get.
+		get.Response.ClientDataJSON = reg.Response.ClientDataJSON
+		if _, err := verify(t, rp, get, cred, []byte("c"), 0, true); err == nil {
+			t.Fatal("accepted create client data in an assertion")
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := softauthn.New(testRPID, testOrigin)
+		if _, err := register(t, rp, other, true); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := other.Get(b64.EncodeToString([]byte("c")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verify(t, rp, resp, cred, []byte("c"), 0, true); !errors.Is(err, ErrSignature) {
+			t.Fatalf("err = %v, want %v", err, ErrSignature)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		resp, err := auth.Get(b64.EncodeToString([]byte("c")), b64.EncodeToString(cred.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ad := decode(t, resp.Response.AuthenticatorData)
+		ad[36]++ // the sign counter
+		resp.Response.AuthenticatorData = b64.EncodeToString(ad)
+		if _, err := verify(t, rp, resp, cred, []byte("c"), 0, true); !errors.Is(err, ErrSignature) {
+			t.Fatalf("err = %v, want %v", err, ErrSignature)
+		}
+	})
+}
+
+func TestMalformedCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"empty", nil},
+		{"truncated uint", []byte{0x19, 0x01}},
+		{"byte string longer than input", []byte{0x45, 0x01, 0x02}},
+		{"text string longer than input", []byte{0x78, 0xff, 'a'}},
+		{"array missing items", []byte{0x83, 0x01, 0x02}},
+		{"map missing value", []byte{0xa1, 0x01}},
+		{"map with a byte string key", []byte{0xa1, 0x41, 0x00, 0x01}},
+		{"huge array length", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"huge byte string length", []byte{0x5b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"uint above int64", []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"indefinite length", []byte{0x5f, 0x41, 0x00, 0xff}},
+		{"tag", []byte{0xc0, 0x01}},
+		{"reserved additional info", []byte{0x1c}},
+		{"nested too deep", append(repeat(0x81, 20), 0x01)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, _, err := decodeCBOR(tt.in); err == nil {
+				t.Fatalf("decoded %v", v)
+			}
+		})
+	}
+
+	// Well-formed items decode, reporting the bytes they used.
+	v, n, err := decodeCBOR([]byte{0xa2, 0x01, 0x02, 0x20, 0x43, 'a', 'b', 'c', 0xff})
+	if err != nil || n != 8 {
+		t.Fatalf("decodeCBOR = %v, %d, %v", v, n, err)
+	}
+	m := v.(map[interface{}]interface{})
+	if m[int64(1)] != int64(2) || string(m[int64(-1)].([]byte)) != "abc" {
+		t.Fatalf("decoded %v", m)
+	}
+
+	rp := testRP()
+	resp, err := softauthn.New(testRPID, testOrigin).Create(b64.EncodeToString([]byte("c")), b64.EncodeToString([]byte("u")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientData := decode(t, resp.Response.ClientDataJSON)
+	att := decode(t, resp.Response.AttestationObject)
+	for _, cut := range []int{1, 10, len(att) / 2, len(att) - 1} {
+		if _, err := rp.VerifyRegistration([]byte("c"), clientData, att[:cut], false); err == nil {
+			t.Errorf("accepted an attestation object cut to %d bytes", cut)
+		}
+	}
+	if _, err := rp.VerifyRegistration([]byte("c"), clientData, []byte{0x01}, false); err == nil {
+		t.Error("accepted an attestation object that is not a map")
+	}
+	if _, err := parseCOSEKey([]byte{0xa1, 0x01, 0x02}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("COSE key without alg: err = %v", err)
+	}
+}
+
+func repeat(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}